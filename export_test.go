@@ -0,0 +1,74 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// Internals, which are used by tests of the external_test package.
+
+// NewMsgReader returns a reader of messages from r, see msgReader.
+func NewMsgReader(r io.Reader, iMaxSize int) interface{ ReadMsg() ([]byte, error) } {
+	return newMsgReader(r, iMaxSize)
+}
+
+// NewPollFileTransport is NewFileTransport, which polls a file instead of using system notifications.
+func NewPollFileTransport(sPath string, tReply time.Duration, iMaxSize int) Transport {
+	p := NewFileTransport(sPath, tReply, iMaxSize).(*fileTransport)
+	p.bPoll = true
+	return p
+}
+
+// Recorded returns messages, which are recorded for a window pWnd to send after reconnecting.
+func Recorded(pWnd *Widget) []string {
+	s := pWnd.session()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var aMsg []string
+	if pWnd.rlog != nil {
+		for _, m := range pWnd.rlog.aMsg {
+			b, _ := protocol.Marshal(m)
+			aMsg = append(aMsg, string(b))
+		}
+	}
+	return aMsg
+}
+
+var VerCmp = verCmp
+
+// Share shares iExtra between items with stretch factors aStretch, see share.
+func Share(aSizes []int, aStretch []int, iExtra int) []int {
+	aItems := make([]layoutItem, len(aStretch))
+	for i := range aStretch {
+		aItems[i].iStretch = aStretch[i]
+	}
+	return share(aSizes, aItems, iExtra)
+}
+
+// Arrange arranges widgets of a layout l in a rectangle without sending anything.
+func Arrange(l Layout, x, y, w, h int) {
+	l.arrange(x, y, w, h)
+}
+
+// SetField sets a field, pointed by pField, to a value sValue, see setField.
+func SetField(pField interface{}, sValue string) error {
+	return setField(reflect.ValueOf(pField).Elem(), sValue)
+}
+
+// PageSource is a browseSource for tests.
+type PageSource struct{ b *browseSource }
+
+func NewPageSource(src BrowseSource, iPageSize int) PageSource {
+	return PageSource{&browseSource{src: src, iPageSize: iPageSize, iPage: -1}}
+}
+
+func (p PageSource) Row(i int) ([]string, error) {
+	return p.b.row(i)
+}
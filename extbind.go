@@ -0,0 +1,251 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// DateFormat is a format of dates, which are passed to and from the GuiServer as strings,
+// see SetValue and Collect.
+const DateFormat = "20060102"
+
+// SetValue sets a value xValue to a widget o according to its type: a text of "edit" and
+// "label" widgets, a state of a "check" (bool), a selected item of a "combo" and "radiogr" (int),
+// a value of an "updown" (int), a date of a "monthcal" (time.Time).
+func (o *Widget) SetValue(xValue interface{}) error {
+
+	var sName = widgFullName(o)
+	var xParam interface{}
+
+	switch o.Type {
+	case "edit", "label", "":
+		return o.SetText(valueString(xValue))
+	case "check":
+		b, bOk := xValue.(bool)
+		if !bOk {
+			return fmt.Errorf("%w: %s needs bool, not %T", ErrWrongType, o.Name, xValue)
+		}
+		xParam = b
+	case "combo", "radiogr", "updown":
+		rv := reflect.ValueOf(xValue)
+		if !rv.CanInt() {
+			return fmt.Errorf("%w: %s needs int, not %T", ErrWrongType, o.Name, xValue)
+		}
+		xParam = rv.Int()
+	case "monthcal":
+		t, bOk := xValue.(time.Time)
+		if !bOk {
+			return fmt.Errorf("%w: %s needs time.Time, not %T", ErrWrongType, o.Name, xValue)
+		}
+		xParam = t.Format(DateFormat)
+	default:
+		return fmt.Errorf("%w: %s is \"%s\"", ErrWrongType, o.Name, o.Type)
+	}
+	sParams := protocol.Set{Name: sName, Prop: "setval", Value: xParam}
+	o.session().record(o, sName+".setval", sParams)
+	return o.session().sendout(sParams)
+}
+
+// valueString converts a value of a struct field to a text of a widget.
+func valueString(xValue interface{}) string {
+	switch v := xValue.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "t"
+		}
+		return "f"
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(DateFormat)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(xValue)
+}
+
+// boundField is a field of a model, bound to a widget by a tag.
+type boundField struct {
+	sName string // a widget name
+	rv    reflect.Value
+}
+
+// boundFields returns fields of a struct, pointed by pModel, which have egui tags.
+func boundFields(pModel interface{}) ([]boundField, error) {
+	rv := reflect.ValueOf(pModel)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("external: a pointer to a struct is needed, not %T", pModel)
+	}
+	rv = rv.Elem()
+	var aFields []boundField
+	for i := 0; i < rv.NumField(); i++ {
+		sName := rv.Type().Field(i).Tag.Get("egui")
+		if sName == "" || sName == "-" || !rv.Type().Field(i).IsExported() {
+			continue
+		}
+		aFields = append(aFields, boundField{sName: sName, rv: rv.Field(i)})
+	}
+	return aFields, nil
+}
+
+// Bind sets values of fields of a struct, pointed by pModel, to widgets inside a window
+// or a widget pWnd. Fields are bound to widgets by tags with widget names:
+//
+//	type Person struct {
+//		Name    string    `egui:"edtName"`
+//		Born    time.Time `egui:"calBorn"`
+//		Married bool      `egui:"chkMarried"`
+//		Age     int       `egui:"updAge"`
+//	}
+//
+//	egui.Bind(pDlg, &person)
+//
+// Values are set by SetValue, so a type of a field must fit a type of a widget;
+// fields of any type may be bound to "edit" widgets. Fields without tags are skipped.
+func Bind(pWnd *Widget, pModel interface{}) error {
+	aFields, err := boundFields(pModel)
+	if err != nil {
+		return err
+	}
+	for _, f := range aFields {
+		o := findByName(pWnd, f.sName)
+		if o == nil {
+			return fmt.Errorf("external: no widget %s in %s", f.sName, pWnd.Name)
+		}
+		if err = o.SetValue(f.rv.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Collect reads values of widgets inside a window or a widget pWnd to fields of a struct,
+// pointed by pModel, with one request to the GuiServer; fields are bound by tags, as for Bind.
+// Strings are converted to types of fields: ints, floats, bools ("t", "true", "1", etc.)
+// and time.Time (DateFormat, "2006-01-02" and time.RFC3339 are accepted).
+func Collect(pWnd *Widget, pModel interface{}) error {
+	aFields, err := boundFields(pModel)
+	if err != nil {
+		return err
+	}
+	aNames := make([]string, len(aFields))
+	for i, f := range aFields {
+		o := findByName(pWnd, f.sName)
+		if o == nil {
+			return fmt.Errorf("external: no widget %s in %s", f.sName, pWnd.Name)
+		}
+		aNames[i] = windowName(o)
+	}
+	arr, err := pWnd.session().GetValues(pWnd.window(), aNames)
+	if err != nil {
+		return err
+	}
+	for i, f := range aFields {
+		if i >= len(arr) {
+			break
+		}
+		if err = setField(f.rv, strings.TrimSpace(arr[i])); err != nil {
+			return fmt.Errorf("external: %s: %w", f.sName, err)
+		}
+	}
+	return nil
+}
+
+// setField converts a value sValue of a widget to a type of a field rv and sets it.
+func setField(rv reflect.Value, sValue string) error {
+
+	if rv.Type() == reflect.TypeOf(time.Time{}) {
+		var t time.Time
+		if sValue != "" {
+			var err error
+			for _, sLayout := range []string{DateFormat, "2006-01-02", time.RFC3339} {
+				if t, err = time.ParseInLocation(sLayout, sValue, time.Local); err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		rv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(sValue)
+	case reflect.Bool:
+		switch strings.ToLower(sValue) {
+		case "t", ".t.", "true", "y", "1":
+			rv.SetBool(true)
+		case "f", ".f.", "false", "n", "0", "":
+			rv.SetBool(false)
+		default:
+			return fmt.Errorf("%q is not a logical value", sValue)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if sValue == "" {
+			rv.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(sValue, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if sValue == "" {
+			rv.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(sValue, 10, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if sValue == "" {
+			rv.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(sValue, rv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetFloat(f)
+	default:
+		return fmt.Errorf("%s fields aren't supported", rv.Type())
+	}
+	return nil
+}
+
+// windowName returns a name of a widget o relative to its window, as "getvalues" expects it:
+// "panel.edit" for "main.panel.edit".
+func windowName(o *Widget) string {
+	return strings.TrimPrefix(widgFullName(o), o.window().Name+".")
+}
+
+// findByName returns a widget with a name sName inside o: o.Name + "." + sName
+// or, if it isn't found, any widget inside o with this name.
+func findByName(o *Widget, sName string) *Widget {
+	if p := o.session().Widg(widgFullName(o) + "." + sName); p != nil {
+		return p
+	}
+	if aWidgs := FindAll(o, func(p *Widget) bool { return p.Name == sName }); len(aWidgs) > 0 {
+		return aWidgs[0]
+	}
+	return nil
+}
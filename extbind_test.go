@@ -0,0 +1,181 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+func TestSetField(t *testing.T) {
+	var (
+		s   string
+		b   bool
+		i   int
+		i8  int8
+		u   uint16
+		f   float64
+		f32 float32
+		tm  time.Time
+		c   complex64
+	)
+	for _, tc := range []struct {
+		pField interface{}
+		sValue string
+		sWant  string // a value of a field after setting or "!" for an error
+	}{
+		{&s, "abc", "abc"},
+		{&s, "", ""},
+		{&b, "t", "true"},
+		{&b, ".T.", "true"},
+		{&b, "Y", "true"},
+		{&b, "1", "true"},
+		{&b, "f", "false"},
+		{&b, "", "false"},
+		{&b, "maybe", "!"},
+		{&i, "42", "42"},
+		{&i, "-7", "-7"},
+		{&i, "", "0"},
+		{&i, "4.5", "!"},
+		{&i8, "127", "127"},
+		{&i8, "128", "!"},
+		{&u, "65535", "65535"},
+		{&u, "-1", "!"},
+		{&f, "1234.5", "1234.5"},
+		{&f, "", "0"},
+		{&f, "x", "!"},
+		{&f32, "0.25", "0.25"},
+		{&tm, "20240131", "2024-01-31"},
+		{&tm, "2024-02-29", "2024-02-29"},
+		{&tm, "2024-03-01T10:00:00Z", "2024-03-01"},
+		{&tm, "", "0001-01-01"},
+		{&tm, "31.01.2024", "!"},
+		{&c, "1", "!"},
+	} {
+		err := egui.SetField(tc.pField, tc.sValue)
+		if tc.sWant == "!" {
+			if err == nil {
+				t.Errorf("%T from %q: no error", tc.pField, tc.sValue)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%T from %q: %v", tc.pField, tc.sValue, err)
+			continue
+		}
+		var sRes string
+		if pt, bOk := tc.pField.(*time.Time); bOk {
+			sRes = pt.Format("2006-01-02")
+		} else {
+			sRes = fmt.Sprint(reflect.ValueOf(tc.pField).Elem())
+		}
+		if sRes != tc.sWant {
+			t.Errorf("%T from %q = %s, want %s", tc.pField, tc.sValue, sRes, tc.sWant)
+		}
+	}
+}
+
+type person struct {
+	Name    string    `egui:"edtName"`
+	Born    time.Time `egui:"calBorn"`
+	Married bool      `egui:"chkMarried"`
+	Age     int       `egui:"updAge"`
+	Salary  float64   `egui:"edtSalary"`
+	Kind    int       `egui:"cmbKind"`
+	Note    string
+}
+
+// personDialog creates a dialog with widgets for a person, some of them are on a panel.
+func personDialog(t *testing.T, s *egui.Session) *egui.Widget {
+	t.Helper()
+	mainWindow(t, s)
+	pDlg := &egui.Widget{Name: "dlg"}
+	if err := s.InitDialog(pDlg); err != nil {
+		t.Fatal(err)
+	}
+	pPanel, _ := pDlg.Add(&egui.Widget{Type: "panel", Name: "pnl"})
+	for _, p := range []*egui.Widget{
+		{Type: "edit", Name: "edtName"},
+		{Type: "monthcal", Name: "calBorn"},
+		{Type: "check", Name: "chkMarried"},
+		{Type: "combo", Name: "cmbKind"},
+	} {
+		if _, err := pDlg.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []*egui.Widget{
+		{Type: "updown", Name: "updAge"},
+		{Type: "edit", Name: "edtSalary"},
+	} {
+		if _, err := pPanel.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pDlg
+}
+
+func TestBindCollect(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pDlg := personDialog(t, s)
+
+	for _, in := range []person{
+		{Name: "Bob", Born: time.Date(1980, 5, 3, 0, 0, 0, 0, time.Local), Married: true, Age: 44, Salary: 1234.5, Kind: 2},
+		{Name: "", Age: -1, Salary: 0.1},
+	} {
+		if err := egui.Bind(pDlg, &in); err != nil {
+			t.Fatal(err)
+		}
+		out := person{Note: "kept"}
+		if err := egui.Collect(pDlg, &out); err != nil {
+			t.Fatal(err)
+		}
+		in.Note = "kept"
+		if !out.Born.Equal(in.Born) {
+			t.Errorf("born %v, want %v", out.Born, in.Born)
+		}
+		out.Born = in.Born
+		if out != in {
+			t.Errorf("collected %+v, want %+v", out, in)
+		}
+	}
+	// Widgets on the panel are asked by names, relative to the dialog.
+	aMsg := srv.Messages()
+	if sWant := `["getvalues","dlg",["edtName","calBorn","chkMarried","pnl.updAge","pnl.edtSalary","cmbKind"]]`; aMsg[len(aMsg)-1] != sWant {
+		t.Errorf("%s, want %s", aMsg[len(aMsg)-1], sWant)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pDlg := personDialog(t, s)
+
+	if err := egui.Bind(pDlg, person{}); err == nil {
+		t.Error("Bind to a struct value: no error")
+	}
+	var pt struct {
+		Married string `egui:"chkMarried"`
+	}
+	if err := egui.Bind(pDlg, &pt); !errors.Is(err, egui.ErrWrongType) {
+		t.Errorf("Bind a string to a check: %v, want ErrWrongType", err)
+	}
+	var pn struct {
+		X string `egui:"edtNone"`
+	}
+	if err := egui.Bind(pDlg, &pn); err == nil {
+		t.Error("Bind to an absent widget: no error")
+	}
+	if err := egui.Collect(pDlg, &pn); err == nil {
+		t.Error("Collect from an absent widget: no error")
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// BrowseSource provides data for a browse page by page, see BrwSetSource.
+type BrowseSource interface {
+	// RowCount returns a number of rows.
+	RowCount() int
+	// Rows returns up to iLimit rows, starting from a row iOffset (0-based).
+	Rows(iOffset, iLimit int) ([][]string, error)
+}
+
+// SliceSource is a BrowseSource for a two-dimensional slice.
+type SliceSource [][]string
+
+func (arr SliceSource) RowCount() int {
+	return len(arr)
+}
+
+func (arr SliceSource) Rows(iOffset, iLimit int) ([][]string, error) {
+	if iOffset >= len(arr) {
+		return nil, nil
+	}
+	return arr[iOffset:min(iOffset+iLimit, len(arr))], nil
+}
+
+// DefaultPageSize is a number of rows, which a browse source is asked for at once.
+const DefaultPageSize = 100
+
+// browseSource keeps a source of a browse and a last page, read from it.
+type browseSource struct {
+	mux       sync.Mutex
+	src       BrowseSource
+	iPageSize int
+	iPage     int // a number of a page in aPage, -1, if there is no page
+	aPage     [][]string
+}
+
+// BrwSetSource sets a source of data for a browse widget p instead of a slice, passed by BrwSetArray.
+// Rows aren't sent to the GuiServer at once: when the browse shows a row, which it hasn't got,
+// it asks the program for a page of iPageSize rows (DefaultPageSize, if it is 0) with it,
+// the page is read from src by Rows, so a size of data doesn't matter.
+// The current page is kept in the "cargo" variable of the HwGUI browse, so it mustn't be
+// used by a program. A number of columns is defined by a first row; rows are read-only,
+// BrwGetArray returns an error for such a browse. A number of rows is read by RowCount once
+// and is passed to the browse as a constant, so BrwRefresh must be called, when rows
+// are added or removed, and when data of src are changed.
+func BrwSetSource(p *Widget, src BrowseSource, iPageSize int) error {
+	if err := checkType(p, "browse"); err != nil {
+		return err
+	}
+	if iPageSize <= 0 {
+		iPageSize = DefaultPageSize
+	}
+	p.pSource = &browseSource{src: src, iPageSize: iPageSize, iPage: -1}
+	return brwSetSource(p)
+}
+
+// BrwRefresh rereads a number of rows and rows of a browse widget p from its source,
+// set by BrwSetSource, sends the number again and redraws the browse.
+func BrwRefresh(p *Widget) error {
+	if p.pSource == nil {
+		return fmt.Errorf("external: %s has no source", p.Name)
+	}
+	p.pSource.mux.Lock()
+	p.pSource.iPage, p.pSource.aPage = -1, nil
+	p.pSource.mux.Unlock()
+	return brwSetSource(p)
+}
+
+// brwSetSource sends a first row of a source of p to create columns, then replaces
+// code blocks of the HwGUI browse: bRcou returns a number of rows, which is fixed
+// till the next call (see BrwRefresh), and blocks of columns
+// take a current row from a page in a cargo {nFirst, aRows}, asking the program for
+// a new page, when a current row is out of it. Messages are sent in one packet.
+func brwSetSource(p *Widget) error {
+
+	s := p.session()
+	b := p.pSource
+	iRows := b.src.RowCount()
+	arr := [][]string{}
+	if iRows > 0 {
+		aRow, err := b.row(0)
+		if err != nil {
+			return err
+		}
+		arr = append(arr, aRow)
+	}
+	sFunc := s.handler(p, "brwsource", false, func(a []string) string {
+		if len(a) < 2 {
+			return "[]"
+		}
+		iFirst, _ := strconv.Atoi(strings.TrimSpace(a[1]))
+		aPage, err := b.page(iFirst - 1)
+		if err != nil {
+			s.logger().Error("browse source", "widget", a[0], "row", iFirst, "err", err)
+		}
+		if aPage == nil {
+			aPage = [][]string{}
+		}
+		bPage, _ := json.Marshal(aPage)
+		return string(bPage)
+	})
+	// nFirst is a first row of a page with the current row
+	sFirst := fmt.Sprintf("Int((o:nCurrent-1)/%d)*%d+1", b.iPageSize, b.iPageSize)
+	sFetch := "hb_defaultValue(hb_jsonDecode(fgo(" + protocol.HbString(sFunc) + ",{" +
+		protocol.HbString(widgFullName(p)) + ",Ltrim(Str(" + sFirst + "))})),{})"
+	sRow := "o:cargo[2,o:nCurrent-o:cargo[1]+1]"
+	sBlock := "{|v,o,n|Iif(o:nCurrent>=o:cargo[1].and.o:nCurrent<o:cargo[1]+Len(o:cargo[2]),NIL," +
+		"o:cargo:={" + sFirst + "," + sFetch + "})," +
+		"Iif(o:nCurrent-o:cargo[1]+1>Len(o:cargo[2]).or.n>Len(" + sRow + "),\"\"," + sRow + "[n])}"
+
+	sName := widgFullName(p)
+	aKeys := []string{sName + ".brwarr", sName + ".xparam.cargo", sName + ".xparam.bRcou"}
+	aMsg := []protocol.Msg{
+		protocol.Set{Name: sName, Prop: "brwarr", Value: arr},
+		protocol.Set{Name: sName, Prop: "xparam", Value: []interface{}{"cargo", []interface{}{0, []string{}}, "d"}},
+		protocol.Set{Name: sName, Prop: "xparam", Value: []interface{}{"bRcou", fmt.Sprintf("{||%d}", iRows), "b"}},
+	}
+	if len(arr) > 0 {
+		for ic := 1; ic <= len(arr[0]); ic++ {
+			aKeys = append(aKeys, fmt.Sprintf("%s.brwcolx.%d.block", sName, ic))
+			aMsg = append(aMsg, protocol.Set{Name: sName, Prop: "brwcolx", Value: []interface{}{ic, "block", sBlock, "b"}})
+		}
+	}
+	for i, m := range aMsg {
+		s.record(p, aKeys[i], m)
+	}
+	return s.sendPacket(aMsg)
+}
+
+// page returns a page of rows with a row i (0-based), reading it, if needed;
+// it returns nil, if there is no such row.
+func (b *browseSource) page(i int) ([][]string, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if i < 0 {
+		return nil, nil
+	}
+	iPage := i / b.iPageSize
+	if iPage != b.iPage {
+		arr, err := b.src.Rows(iPage*b.iPageSize, b.iPageSize)
+		if err != nil {
+			return nil, err
+		}
+		b.iPage, b.aPage = iPage, arr
+	}
+	return b.aPage, nil
+}
+
+// row returns a copy of a row i (0-based), reading a page with it, if needed.
+func (b *browseSource) row(i int) ([]string, error) {
+	aPage, err := b.page(i)
+	if err != nil || i < 0 {
+		return nil, err
+	}
+	i -= i / b.iPageSize * b.iPageSize
+	if i >= len(aPage) {
+		return nil, nil
+	}
+	return append([]string(nil), aPage[i]...), nil
+}
+
+// SetSource sets a source of data for a browse, see BrwSetSource.
+func (p *Browse) SetSource(src BrowseSource, iPageSize int) error {
+	return BrwSetSource(p.Widget, src, iPageSize)
+}
+
+// Refresh rereads data of a browse from its source, see BrwRefresh.
+func (p *Browse) Refresh() error {
+	return BrwRefresh(p.Widget)
+}
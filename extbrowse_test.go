@@ -0,0 +1,188 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+// countSource is a BrowseSource of iRows rows, which counts calls of Rows.
+type countSource struct {
+	iRows  int
+	aCalls []string
+	err    error
+}
+
+func (p *countSource) RowCount() int {
+	return p.iRows
+}
+
+func (p *countSource) Rows(iOffset, iLimit int) ([][]string, error) {
+	p.aCalls = append(p.aCalls, fmt.Sprintf("%d+%d", iOffset, iLimit))
+	if p.err != nil {
+		return nil, p.err
+	}
+	var arr [][]string
+	for i := iOffset; i < iOffset+iLimit && i < p.iRows; i++ {
+		arr = append(arr, []string{fmt.Sprint(i + 1), "name\t" + fmt.Sprint(i+1)})
+	}
+	return arr, nil
+}
+
+func TestBrowseSourceRow(t *testing.T) {
+	for _, tc := range []struct {
+		sName     string
+		iRows     int
+		iPageSize int
+		aRows     []int    // rows, which are asked in order
+		aWant     []string // first cells of rows, "-" for no row
+		aCalls    []string // calls of Rows
+	}{
+		{"first page", 25, 10, []int{0, 9, 5}, []string{"1", "10", "6"}, []string{"0+10"}},
+		{"page edges", 25, 10, []int{9, 10, 19, 20}, []string{"10", "11", "20", "21"},
+			[]string{"0+10", "10+10", "20+10"}},
+		{"back", 25, 10, []int{15, 5, 15}, []string{"16", "6", "16"}, []string{"10+10", "0+10", "10+10"}},
+		{"last, short page", 25, 10, []int{24, 25, 29}, []string{"25", "-", "-"}, []string{"20+10"}},
+		{"after the end", 25, 10, []int{30, 100}, []string{"-", "-"}, []string{"30+10", "100+10"}},
+		{"negative", 25, 10, []int{-1}, []string{"-"}, nil},
+		{"page of one row", 3, 1, []int{0, 1, 1, 2}, []string{"1", "2", "2", "3"}, []string{"0+1", "1+1", "2+1"}},
+		{"empty", 0, 10, []int{0}, []string{"-"}, []string{"0+10"}},
+	} {
+		t.Run(tc.sName, func(t *testing.T) {
+			src := &countSource{iRows: tc.iRows}
+			p := egui.NewPageSource(src, tc.iPageSize)
+			for i, iRow := range tc.aRows {
+				aRow, err := p.Row(iRow)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sFirst := "-"
+				if aRow != nil {
+					sFirst = aRow[0]
+				}
+				if sFirst != tc.aWant[i] {
+					t.Errorf("row %d: %s, want %s", iRow, sFirst, tc.aWant[i])
+				}
+			}
+			if strings.Join(src.aCalls, ",") != strings.Join(tc.aCalls, ",") {
+				t.Errorf("calls %v, want %v", src.aCalls, tc.aCalls)
+			}
+		})
+	}
+}
+
+func TestBrowseSourceError(t *testing.T) {
+	errSrc := errors.New("no data")
+	src := &countSource{iRows: 5, err: errSrc}
+	p := egui.NewPageSource(src, 10)
+	if _, err := p.Row(0); !errors.Is(err, errSrc) {
+		t.Errorf("%v, want %v", err, errSrc)
+	}
+	// A page isn't kept after an error.
+	src.err = nil
+	if aRow, err := p.Row(0); err != nil || aRow[0] != "1" {
+		t.Errorf("%v, %v after an error", aRow, err)
+	}
+}
+
+func TestBrwSetSource(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pWnd := mainWindow(t, s)
+	pBrw, err := pWnd.AddBrowse(&egui.Widget{Name: "brw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &countSource{iRows: 1000}
+	if err = pBrw.SetSource(src, 50); err != nil {
+		t.Fatal(err)
+	}
+	aMsg := srv.Messages()
+	sLast := aMsg[len(aMsg)-1]
+	if !strings.HasPrefix(sLast, `["packet",`) || !strings.Contains(sLast, `{||1000}`) ||
+		strings.Count(sLast, `"brwcolx"`) != 2 {
+		t.Errorf("wrong packet: %s", sLast)
+	}
+	if o, _ := srv.Widget("main.brw"); fmt.Sprint(o.Params["xparam.cargo"]) != "[0 []]" {
+		t.Errorf("cargo %v", o.Params["xparam.cargo"])
+	}
+	if _, err = pBrw.Array(); err == nil {
+		t.Error("Array of a browse with a source: no error")
+	}
+
+	o, _ := srv.Widget("main.brw")
+	m := reHandler.FindStringSubmatch(fmt.Sprint(o.Params["brwcolx"]))
+	if m == nil {
+		t.Fatalf("no handler in %v", o.Params["brwcolx"])
+	}
+	for _, tc := range []struct {
+		sFirst string // a first row of a page (1-based)
+		iLen   int
+		sCell  string // a second cell of a first row of a page
+	}{
+		{"1", 50, "name\t1"},
+		{"51", 50, "name\t51"},
+		{"951", 50, "name\t951"},
+		{"1001", 0, ""},
+	} {
+		sRes, err := srv.RunFunc(m[1], "main.brw", tc.sFirst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var aPage [][]string
+		if err = json.Unmarshal([]byte(sRes), &aPage); err != nil {
+			t.Fatalf("%s: %q: %v", tc.sFirst, sRes, err)
+		}
+		if len(aPage) != tc.iLen || (tc.iLen > 0 && aPage[0][1] != tc.sCell) {
+			t.Errorf("%s: %d rows %v", tc.sFirst, len(aPage), aPage[:min(len(aPage), 1)])
+		}
+	}
+
+	// The generated code
+	sFirst := "Int((o:nCurrent-1)/50)*50+1"
+	sRow := "o:cargo[2,o:nCurrent-o:cargo[1]+1]"
+	// wantPacket returns a packet for a number of rows sRows and a handler sFunc.
+	wantPacket := func(sRows string, sFunc string) []interface{} {
+		sBlock := "{|v,o,n|Iif(o:nCurrent>=o:cargo[1].and.o:nCurrent<o:cargo[1]+Len(o:cargo[2]),NIL," +
+			"o:cargo:={" + sFirst + `,hb_defaultValue(hb_jsonDecode(fgo("` + sFunc + `",{"main.brw",Ltrim(Str(` + sFirst + `))})),{})}),` +
+			"Iif(o:nCurrent-o:cargo[1]+1>Len(o:cargo[2]).or.n>Len(" + sRow + `),"",` + sRow + "[n])}"
+		return []interface{}{"packet",
+			[]interface{}{"set", "main.brw", "brwarr", [][]string{{"1", "name\t1"}}},
+			[]interface{}{"set", "main.brw", "xparam", []interface{}{"cargo", []interface{}{0, []string{}}, "d"}},
+			[]interface{}{"set", "main.brw", "xparam", []interface{}{"bRcou", "{||" + sRows + "}", "b"}},
+			[]interface{}{"set", "main.brw", "brwcolx", []interface{}{1, "block", sBlock, "b"}},
+			[]interface{}{"set", "main.brw", "brwcolx", []interface{}{2, "block", sBlock, "b"}},
+		}
+	}
+	if b, _ := json.Marshal(wantPacket("1000", m[1])); string(b) != sLast {
+		t.Errorf("packet\n%s\nwant\n%s", sLast, b)
+	}
+
+	// The number of rows is sent again by Refresh.
+	src.iRows = 3
+	if err = pBrw.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	aMsg = srv.Messages()
+	sLast = aMsg[len(aMsg)-1]
+	// Refresh registers a new handler.
+	o, _ = srv.Widget("main.brw")
+	if m = reHandler.FindStringSubmatch(fmt.Sprint(o.Params["brwcolx"])); m == nil {
+		t.Fatalf("no handler in %v", o.Params["brwcolx"])
+	}
+	if b, _ := json.Marshal(wantPacket("3", m[1])); string(b) != sLast {
+		t.Errorf("refresh\n%s\nwant\n%s", sLast, b)
+	}
+	if err = egui.BrwRefresh(pWnd); err == nil {
+		t.Error("BrwRefresh of a window: no error")
+	}
+}
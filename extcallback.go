@@ -0,0 +1,270 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// mBlockPars declares callbacks, which code blocks have parameters besides a widget:
+// values of them are passed to a program after a widget name, see SetCallBackProc.
+// A new callback kind needs a line here and, for a typed handler, an event type
+// with an On... method, which fills it (see OnPosChanged).
+// "onsize" isn't here: SetCallBackProc passes only a widget name for it, as before,
+// a width and a height are passed to handlers, set by OnSize.
+var mBlockPars = map[string]string{
+	"onposchanged": "o,n",
+	"onrclick":     "o,nc,nr",
+	"onenter":      "o,nc,nr",
+}
+
+// ClickEvent is passed to a handler, set by OnClick.
+type ClickEvent struct {
+	Widget *Widget // A widget, which is clicked
+}
+
+// Event is passed to a handler, set by On or OnFunc.
+type Event struct {
+	Widget *Widget  // A widget, which the callback belongs to
+	Name   string   // A callback name: "onclick", "onsize", etc.
+	Args   []string // Values of code block parameters (see mBlockPars), then parameters of SetCallBackProc, if any
+}
+
+// PosChangedEvent is passed to a handler, set by OnPosChanged.
+type PosChangedEvent struct {
+	Widget *Widget // A browse, a combobox, etc.
+	Pos    int     // A new position: a row number of a browse, an item number of a combobox
+}
+
+// CellEvent is passed to a handler, set by OnRClick or OnEnter.
+type CellEvent struct {
+	Widget *Widget // A browse
+	Col    int     // A column number
+	Row    int     // A row number
+}
+
+// SizeEvent is passed to a handler, set by OnSize.
+type SizeEvent struct {
+	Widget *Widget // A widget or a window, which is resized
+	Width  int     // A new width of the parent window client area
+	Height int     // A new height of the parent window client area
+}
+
+// MenuEvent is passed to a handler, set by AddMenuFunc or AddCheckMenuFunc.
+type MenuEvent struct {
+	Window *Widget // A window, which the menu belongs to, nil for menus, defined before any window
+	Id     int     // A menu item id, as it is passed to AddMenuFunc
+}
+
+// ResultEvent is passed to a handler, wrapped by OnResult, when a standard dialog (MsgYesNo,
+// MsgGet, Choice, SelectFile, etc.) or a printer setup is completed.
+type ResultEvent struct {
+	Name  string   // An sName parameter of the dialog function, a font name for SelectFont
+	Value string   // A result: "t" or "f" for MsgYesNo, a text for MsgGet, a path for SelectFile, etc.
+	Args  []string // All values after Name, for SelectFont - font attributes
+}
+
+// OnResult wraps fu to a callback function for MsgInfo, MsgYesNo, Choice, SelectFile, InitPrinter, etc.
+// If such a function is passed with an empty name, the name is generated and the function is
+// unregistered after the dialog is completed:
+//
+//	egui.MsgYesNo("Save changes?", "Editor", egui.OnResult(func(ev egui.ResultEvent) {
+//		...
+//	}), "", "")
+func OnResult(fu func(ResultEvent)) func([]string) string {
+	return func(p []string) string {
+		var ev ResultEvent
+		if len(p) > 0 {
+			ev.Name = p[0]
+			ev.Args = p[1:]
+		}
+		if len(ev.Args) > 0 {
+			ev.Value = ev.Args[0]
+		}
+		fu(ev)
+		return ""
+	}
+}
+
+// OnClick sets a handler fu for an "onclick" callback of a widget o.
+// A setting of other handler for it replaces the previous one.
+func (o *Widget) OnClick(fu func(ClickEvent)) error {
+	return o.SetCallBackProc("onclick", func([]string) string {
+		fu(ClickEvent{Widget: o})
+		return ""
+	}, "")
+}
+
+// On sets a handler fu for a callback sEvent ("onclick", "onposchanged", "onsize", etc.)
+// of a widget o. A setting of other handler for the same callback replaces the previous one.
+func (o *Widget) On(sEvent string, fu func(Event)) error {
+	return o.SetCallBackProc(sEvent, func(p []string) string {
+		fu(newEvent(o, sEvent, p))
+		return ""
+	}, "")
+}
+
+// OnFunc is the same as On, but the handler returns a value to the GuiServer,
+// as for SetCallBackFunc ("onlostfocus" may return "f" to keep a focus, for example).
+func (o *Widget) OnFunc(sEvent string, fu func(Event) string) error {
+	return o.SetCallBackFunc(sEvent, func(p []string) string {
+		return fu(newEvent(o, sEvent, p))
+	}, "")
+}
+
+// OnPosChanged sets a handler fu for an "onposchanged" callback of a widget o.
+func (o *Widget) OnPosChanged(fu func(PosChangedEvent)) error {
+	return on(o, "onposchanged", fu, func(ev Event) PosChangedEvent {
+		return PosChangedEvent{Widget: ev.Widget, Pos: ev.Int(0)}
+	})
+}
+
+// OnRClick sets a handler fu for an "onrclick" callback of a browse o.
+func (o *Widget) OnRClick(fu func(CellEvent)) error {
+	return on(o, "onrclick", fu, newCellEvent)
+}
+
+// OnEnter sets a handler fu for an "onenter" callback of a browse o.
+func (o *Widget) OnEnter(fu func(CellEvent)) error {
+	return on(o, "onenter", fu, newCellEvent)
+}
+
+// OnSize sets a handler fu for an "onsize" callback of a widget o.
+func (o *Widget) OnSize(fu func(SizeEvent)) error {
+	return o.setCallBackProc("onsize", "o,x,y", func(p []string) string {
+		ev := newEvent(o, "onsize", p)
+		fu(SizeEvent{Widget: o, Width: ev.Int(0), Height: ev.Int(1)})
+		return ""
+	}, "")
+}
+
+func newCellEvent(ev Event) CellEvent {
+	return CellEvent{Widget: ev.Widget, Col: ev.Int(0), Row: ev.Int(1)}
+}
+
+// on sets a handler fu for a callback sEvent of a widget o, mk converts an Event to a typed one.
+func on[E any](o *Widget, sEvent string, fu func(E), mk func(Event) E) error {
+	return o.On(sEvent, func(ev Event) { fu(mk(ev)) })
+}
+
+// Int returns a value of a code block parameter i as an integer, 0, if it is absent or isn't a number.
+func (ev Event) Int(i int) int {
+	if i >= len(ev.Args) {
+		return 0
+	}
+	s := strings.TrimSpace(ev.Args[i])
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return int(f)
+	}
+	return 0
+}
+
+// newEvent creates an Event, p contains a widget name and values of code block parameters.
+func newEvent(o *Widget, sEvent string, p []string) Event {
+	ev := Event{Widget: o, Name: sEvent}
+	if len(p) > 1 {
+		ev.Args = p[1:]
+	}
+	return ev
+}
+
+// AddMenuFunc adds a new item to the Window's menu or submenu, as AddMenuItem does,
+// fu is called, when the item is selected.
+func (s *Session) AddMenuFunc(sName string, id int, fu func(MenuEvent)) {
+	s.AddMenuItem(sName, id, s.menuFunc(id, fu), "")
+}
+
+// AddCheckMenuFunc is the same as AddMenuFunc, but it creates a menu item, which may be checked,
+// see AddCheckMenuItem.
+func (s *Session) AddCheckMenuFunc(sName string, id int, fu func(MenuEvent)) {
+	s.AddCheckMenuItem(sName, id, s.menuFunc(id, fu), "")
+}
+
+func (s *Session) menuFunc(id int, fu func(MenuEvent)) func([]string) string {
+	pWnd := s.lastWnd()
+	return func([]string) string {
+		fu(MenuEvent{Window: pWnd, Id: id})
+		return ""
+	}
+}
+
+// handler registers a function fu with a generated unique name and returns this name.
+// If pOwner isn't nil, the function is unregistered, when pOwner is deleted, and,
+// if sKey isn't empty, when other function is registered with the same sKey for pOwner.
+// If bOnce is true, the function is unregistered after the first call.
+func (s *Session) handler(pOwner *Widget, sKey string, bOnce bool, fu func([]string) string) string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	sName := fmt.Sprintf("%s%d", genPrefix, s.iIdCount)
+	s.iIdCount++
+	s.mfu[sName] = fu
+	if bOnce {
+		s.mOnce[sName] = struct{}{}
+	}
+	if pOwner != nil {
+		if sKey == "" {
+			sKey = sName
+		}
+		if pOwner.mHandlers == nil {
+			pOwner.mHandlers = make(map[string]string)
+		}
+		if sOld, bOk := pOwner.mHandlers[sKey]; bOk {
+			delete(s.mfu, sOld)
+			delete(s.mOnce, sOld)
+		}
+		pOwner.mHandlers[sKey] = sName
+	}
+	return sName
+}
+
+// genPrefix starts names of functions, registered by handler.
+const genPrefix = "_h"
+
+// isGenerated reports, whether sName looks like a name, generated by handler.
+func isGenerated(sName string) bool {
+	sNum, bOk := strings.CutPrefix(sName, genPrefix)
+	if !bOk || sNum == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(sNum, 10, 64)
+	return err == nil
+}
+
+// callback returns a name, under which fu is registered: sName, if it isn't empty,
+// or a generated one (see handler).
+func (s *Session) callback(pOwner *Widget, sKey string, bOnce bool, fu func([]string) string, sName string) string {
+	if sName == "" {
+		return s.handler(pOwner, sKey, bOnce, fu)
+	}
+	s.RegFunc(sName, fu)
+	return sName
+}
+
+// unregister removes functions, registered by handler for o and its children.
+// s.mux must be locked.
+func (s *Session) unregister(o *Widget) {
+	for _, sName := range o.mHandlers {
+		delete(s.mfu, sName)
+		delete(s.mOnce, sName)
+	}
+	o.mHandlers = nil
+	for _, oChild := range o.aWidgets {
+		s.unregister(oChild)
+	}
+}
+
+// dialogFunc registers a callback function of a standard dialog and returns its name
+// and a parameter sName; both are empty, if there is no callback.
+func (s *Session) dialogFunc(fu func([]string) string, sFunc string, sName string) (string, string) {
+	if fu == nil {
+		return "", ""
+	}
+	return s.callback(nil, "", true, fu, sFunc), sName
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"strings"
+	"testing"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+func TestOnSizeParams(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pWnd := mainWindow(t, s)
+	pOld, _ := pWnd.Add(&egui.Widget{Type: "panel", Name: "pnlOld"})
+	pNew, _ := pWnd.Add(&egui.Widget{Type: "panel", Name: "pnlNew"})
+
+	// SetCallBackProc passes only a widget name for "onsize", as it always did.
+	pOld.SetCallBackProc("onsize", func([]string) string { return "" }, "", "p1")
+	pNew.OnSize(func(egui.SizeEvent) {})
+
+	o, _ := srv.Widget("main.pnlOld")
+	if sCode := o.Callbacks["onsize"]; !strings.HasPrefix(sCode, "{||pgo(") || !strings.HasSuffix(sCode, `{"main.pnlOld","p1"})}`) {
+		t.Errorf("SetCallBackProc: %s", sCode)
+	}
+	o, _ = srv.Widget("main.pnlNew")
+	if sCode := o.Callbacks["onsize"]; !strings.HasPrefix(sCode, "{|o,x,y|pgo(") || !strings.HasSuffix(sCode, `{"main.pnlNew",x,y})}`) {
+		t.Errorf("OnSize: %s", sCode)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// Capabilities describe a GuiServer, which a session is connected to.
+// Versions are empty, if the GuiServer doesn't report them.
+type Capabilities struct {
+	Proto     string // A protocol version, received while connecting, one of Options.AcceptProtocols
+	GuiServer string // A GuiServer version, "1.3", for example
+	Harbour   string // A Harbour version, "3.2.0dev", for example
+	HwGUI     string // A HwGUI version
+}
+
+// Features, which may be absent in some GuiServer builds, see Session.Supports.
+const (
+	FeatDestroy = "set.destroy" // Destroying of widgets
+	FeatUnix    = "unix"        // Unix domain sockets, TypeUnix ("-t3" command line option)
+	FeatPipe    = "pipe"        // Pipes of a GuiServer process, TypePipe ("-t4" command line option)
+)
+
+// mDeclared lists features, which no GuiServer release is known to support:
+// a program must declare them by Options.Features (WithFeature) with a version of
+// a GuiServer build, which supports them, see checkDeclared.
+var mDeclared = map[int]string{
+	TypeUnix: FeatUnix,
+	TypePipe: FeatPipe,
+}
+
+// mFeatures keeps minimal GuiServer versions for features and widget types,
+// which are absent in older builds. Features and widget types, which aren't listed here,
+// are supported by all versions. A version is listed here only, if it is known from
+// GuiServer release notes; otherwise a program may set it by Options.Features.
+var mFeatures = map[string]string{}
+
+var reVersion = regexp.MustCompile(`(?i)\b(GuiServer|Harbour|HwGUI)[ /]+([0-9][0-9A-Za-z.\-]*)`)
+
+// parseVersion gets versions of the GuiServer, Harbour and HwGUI from the GetVersion(2) result.
+func parseVersion(sVer string) Capabilities {
+	var caps Capabilities
+	for _, m := range reVersion.FindAllStringSubmatch(sVer, -1) {
+		switch strings.ToLower(m[1]) {
+		case "guiserver":
+			caps.GuiServer = m[2]
+		case "harbour":
+			caps.Harbour = m[2]
+		case "hwgui":
+			caps.HwGUI = m[2]
+		}
+	}
+	return caps
+}
+
+// verCmp compares version strings a and b by their numeric parts: "1.10" > "1.9",
+// a suffix after digits ("3.2.0dev") is ignored. It returns -1, 0 or 1.
+func verCmp(a, b string) int {
+	aa, ab := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aa) || i < len(ab); i++ {
+		var n1, n2 int
+		if i < len(aa) {
+			n1 = leadingInt(aa[i])
+		}
+		if i < len(ab) {
+			n2 = leadingInt(ab[i])
+		}
+		if n1 < n2 {
+			return -1
+		} else if n1 > n2 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func leadingInt(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n
+}
+
+// queryCaps asks the GuiServer for its versions, sProto is a protocol version, received
+// while connecting. An error is returned, if the connection fails only; if the GuiServer
+// doesn't answer properly, versions stay unknown. muxOut must be locked.
+func (s *Session) queryCaps(sProto string) (Capabilities, error) {
+
+	caps := Capabilities{Proto: sProto}
+	bMsg, err := protocol.Marshal(protocol.NewCmd("getver", 2))
+	if err != nil {
+		return caps, err
+	}
+	b, err := s.exchange(bMsg)
+	if err != nil {
+		return caps, err
+	}
+	var sVer string
+	if err = unmarshalReply(b, &sVer); err != nil {
+		s.logger().Warn("GuiServer version is unknown", "err", err)
+		return caps, nil
+	}
+	caps = parseVersion(sVer)
+	caps.Proto = sProto
+	return caps, nil
+}
+
+// Caps returns capabilities of the GuiServer, which the session is connected to.
+func (s *Session) Caps() Capabilities {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.caps
+}
+
+// Supports reports, whether the GuiServer supports a feature (FeatDestroy, for example),
+// a widget type or a command: "getvalues", "set.<property>", "get.<property>", "common.<function>".
+// Messages with commands, which aren't supported, aren't sent, ErrUnsupported is returned.
+// Minimal versions, set in Options.Features, take precedence over the built-in ones.
+// If the GuiServer version is unknown, everything is considered supported.
+func (s *Session) Supports(sFeature string) bool {
+	s.mux.Lock()
+	sVer := s.caps.GuiServer
+	sMin, bOk := s.opts.Features[sFeature]
+	s.mux.Unlock()
+	if !bOk {
+		sMin = mFeatures[sFeature]
+	}
+	if sMin == "" || sVer == "" {
+		return true
+	}
+	return verCmp(sVer, sMin) >= 0
+}
+
+// unsupported returns an error for a feature or a widget type sFeature,
+// which the GuiServer doesn't support.
+func (s *Session) unsupported(sFeature string) error {
+	return &ErrUnsupported{Feature: sFeature, Version: s.Caps().GuiServer}
+}
+
+// checkDeclared returns ErrUnsupported, if a connection type of opts needs a feature,
+// which isn't declared in opts.Features.
+func checkDeclared(opts Options) error {
+	if opts.Transport != nil {
+		return nil
+	}
+	if sFeature, bOk := mDeclared[opts.Type]; bOk {
+		if _, bOk = opts.Features[sFeature]; !bOk {
+			return &ErrUnsupported{Feature: sFeature}
+		}
+	}
+	return nil
+}
+
+// checkCmd returns ErrUnsupported, if the GuiServer doesn't support a command of a message m,
+// see Supports.
+func (s *Session) checkCmd(m protocol.Msg) error {
+	a := m.Array()
+	if len(a) == 0 {
+		return nil
+	}
+	sCmd, _ := a[0].(string)
+	if !s.Supports(sCmd) {
+		return s.unsupported(sCmd)
+	}
+	// A second part of a command: a property for "set" and "get", a function for "common".
+	var i int
+	switch sCmd {
+	case "set", "get":
+		i = 2
+	case "common":
+		i = 1
+	}
+	if i > 0 && i < len(a) {
+		if sSub, bOk := a[i].(string); bOk && !s.Supports(sCmd+"."+sSub) {
+			return s.unsupported(sCmd + "." + sSub)
+		}
+	}
+	return nil
+}
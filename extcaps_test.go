@@ -0,0 +1,93 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"errors"
+	"testing"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+func TestVerCmp(t *testing.T) {
+	for _, tc := range []struct {
+		a, b  string
+		iWant int
+	}{
+		{"1.3", "1.3", 0},
+		{"1.3", "1.4", -1},
+		{"1.4", "1.3", 1},
+		{"1.10", "1.9", 1},
+		{"1.3", "1.3.0", 0},
+		{"1.3.1", "1.3", 1},
+		{"2", "1.99", 1},
+		{"3.2.0dev", "3.2", 0},
+		{"3.2.0dev", "3.2.1", -1},
+		{"", "1.0", -1},
+		{"", "", 0},
+	} {
+		if i := egui.VerCmp(tc.a, tc.b); i != tc.iWant {
+			t.Errorf("verCmp(%q, %q) = %d, want %d", tc.a, tc.b, i, tc.iWant)
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+	for _, tc := range []struct {
+		sName    string
+		sVersion string // a version of the fake GuiServer
+		aOpts    []egui.Option
+		sFeature string
+		bWant    bool
+	}{
+		{"not listed", "1.3", nil, egui.FeatDestroy, true},
+		{"declared older", "1.3", []egui.Option{egui.WithFeature(egui.FeatDestroy, "1.2")}, egui.FeatDestroy, true},
+		{"declared same", "1.3", []egui.Option{egui.WithFeature(egui.FeatDestroy, "1.3")}, egui.FeatDestroy, true},
+		{"declared newer", "1.3", []egui.Option{egui.WithFeature(egui.FeatDestroy, "1.10")}, egui.FeatDestroy, false},
+		{"widget type", "1.3", []egui.Option{egui.WithFeature("cedit", "2.0")}, "cedit", false},
+		{"unknown version", "", []egui.Option{egui.WithFeature(egui.FeatDestroy, "9.0")}, egui.FeatDestroy, true},
+	} {
+		t.Run(tc.sName, func(t *testing.T) {
+			srv := externaltest.NewServer()
+			srv.Version = tc.sVersion
+			s := dial(t, srv, tc.aOpts...)
+			if sVer := s.Caps().GuiServer; sVer != tc.sVersion {
+				t.Errorf("GuiServer version %q, want %q", sVer, tc.sVersion)
+			}
+			if b := s.Supports(tc.sFeature); b != tc.bWant {
+				t.Errorf("Supports(%q) = %v, want %v", tc.sFeature, b, tc.bWant)
+			}
+		})
+	}
+}
+
+func TestUnsupportedCommands(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv, egui.WithFeature("set.color", "1.5"), egui.WithFeature("cedit", "1.5"))
+	pWnd := mainWindow(t, s)
+	pEdit, err := pWnd.Add(&egui.Widget{Type: "edit", Name: "e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uerr *egui.ErrUnsupported
+	if err = pEdit.SetColor(0, 0xffffff); !errors.As(err, &uerr) || uerr.Feature != "set.color" {
+		t.Errorf("SetColor: %v, want ErrUnsupported for set.color", err)
+	}
+	s.BeginPacket()
+	pEdit.SetText("a")
+	err = pEdit.SetColor(0, 0xffffff)
+	s.EndPacket()
+	if !errors.As(err, &uerr) {
+		t.Errorf("SetColor in a packet: %v, want ErrUnsupported", err)
+	}
+	if _, err = pWnd.Add(&egui.Widget{Type: "cedit"}); !errors.As(err, &uerr) || uerr.Feature != "cedit" {
+		t.Errorf("Add cedit: %v, want ErrUnsupported for cedit", err)
+	}
+	if o, _ := srv.Widget("main.e"); o.Text != "a" || o.Params["color"] != nil {
+		t.Errorf("the edit has text %q and color %v", o.Text, o.Params["color"])
+	}
+}
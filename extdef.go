@@ -0,0 +1,296 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"context"
+)
+
+// Package-level functions below work with the default session,
+// which is returned by DefaultSession().
+
+// Exit calls the Exit method of the default session.
+func Exit() {
+	DefaultSession().Exit()
+}
+
+// BeginPacket calls the BeginPacket method of the default session.
+func BeginPacket() {
+	DefaultSession().BeginPacket()
+}
+
+// EndPacket calls the EndPacket method of the default session.
+func EndPacket() error {
+	return DefaultSession().EndPacket()
+}
+
+// RegFunc calls the RegFunc method of the default session.
+func RegFunc(sName string, fu func([]string) string) {
+	DefaultSession().RegFunc(sName, fu)
+}
+
+// Menu calls the Menu method of the default session.
+func Menu(sTitle string) {
+	DefaultSession().Menu(sTitle)
+}
+
+// MenuContext calls the MenuContext method of the default session.
+func MenuContext(sName string) {
+	DefaultSession().MenuContext(sName)
+}
+
+// ShowMenuContext calls the ShowMenuContext method of the default session.
+func ShowMenuContext(sName string, pWnd *Widget) error {
+	return DefaultSession().ShowMenuContext(sName, pWnd)
+}
+
+// EndMenu calls the EndMenu method of the default session.
+func EndMenu() error {
+	return DefaultSession().EndMenu()
+}
+
+// AddMenuItem calls the AddMenuItem method of the default session.
+func AddMenuItem(sName string, id int, fu func([]string) string, sCode string, params ...string) {
+	DefaultSession().AddMenuItem(sName, id, fu, sCode, params...)
+}
+
+// AddCheckMenuItem calls the AddCheckMenuItem method of the default session.
+func AddCheckMenuItem(sName string, id int, fu func([]string) string, sCode string, params ...string) {
+	DefaultSession().AddCheckMenuItem(sName, id, fu, sCode, params...)
+}
+
+// AddMenuSeparator calls the AddMenuSeparator method of the default session.
+func AddMenuSeparator() {
+	DefaultSession().AddMenuSeparator()
+}
+
+// MenuItemEnable calls the MenuItemEnable method of the default session.
+func MenuItemEnable(sWndName string, sMenuName string, iItem int, bValue bool) error {
+	return DefaultSession().MenuItemEnable(sWndName, sMenuName, iItem, bValue)
+}
+
+// MenuItemCheck calls the MenuItemCheck method of the default session.
+func MenuItemCheck(sWndName string, sMenuName string, iItem int, bValue bool) error {
+	return DefaultSession().MenuItemCheck(sWndName, sMenuName, iItem, bValue)
+}
+
+// GetFont calls the GetFont method of the default session.
+func GetFont(sName string) *Font {
+	return DefaultSession().GetFont(sName)
+}
+
+// GetStyle calls the GetStyle method of the default session.
+func GetStyle(sName string) *Style {
+	return DefaultSession().GetStyle(sName)
+}
+
+// Wnd calls the Wnd method of the default session.
+func Wnd(sName string) *Widget {
+	return DefaultSession().Wnd(sName)
+}
+
+// Widg calls the Widg method of the default session.
+func Widg(sName string) *Widget {
+	return DefaultSession().Widg(sName)
+}
+
+// OpenMainForm calls the OpenMainForm method of the default session, it returns false in case of error.
+func OpenMainForm(sForm string) bool {
+	return DefaultSession().OpenMainForm(sForm) == nil
+}
+
+// OpenForm calls the OpenForm method of the default session, it returns false in case of error.
+func OpenForm(sForm string) bool {
+	return DefaultSession().OpenForm(sForm) == nil
+}
+
+// OpenReport calls the OpenReport method of the default session, it returns false in case of error.
+func OpenReport(sForm string) bool {
+	return DefaultSession().OpenReport(sForm) == nil
+}
+
+// CreateFont calls the CreateFont method of the default session, an error is not reported.
+func CreateFont(pFont *Font) *Font {
+	res, _ := DefaultSession().CreateFont(pFont)
+	return res
+}
+
+// CreateStyle calls the CreateStyle method of the default session, an error is not reported.
+func CreateStyle(pStyle *Style) *Style {
+	res, _ := DefaultSession().CreateStyle(pStyle)
+	return res
+}
+
+// CreateHighliter calls the CreateHighliter method of the default session, an error is not reported.
+func CreateHighliter(sName string, sCommands string, sFuncs string, sSingleLineComm string, sMultiLineComm string, bCase bool) *Highlight {
+	res, _ := DefaultSession().CreateHighliter(sName, sCommands, sFuncs, sSingleLineComm, sMultiLineComm, bCase)
+	return res
+}
+
+// InitPrinter calls the InitPrinter method of the default session, an error is not reported.
+func InitPrinter(pPrinter *Printer, sFunc string, fu func([]string) string, sMark string) *Printer {
+	res, _ := DefaultSession().InitPrinter(pPrinter, sFunc, fu, sMark)
+	return res
+}
+
+// InitMainWindow calls the InitMainWindow method of the default session, it returns false in case of error.
+func InitMainWindow(pWnd *Widget) bool {
+	return DefaultSession().InitMainWindow(pWnd) == nil
+}
+
+// InitDialog calls the InitDialog method of the default session, it returns false in case of error.
+func InitDialog(pWnd *Widget) bool {
+	return DefaultSession().InitDialog(pWnd) == nil
+}
+
+// EvalProc calls the EvalProc method of the default session.
+func EvalProc(sCode string) error {
+	return DefaultSession().EvalProc(sCode)
+}
+
+// EvalFunc calls the EvalFunc method of the default session, an error is not reported.
+func EvalFunc(sCode string) []byte {
+	res, _ := DefaultSession().EvalFunc(sCode)
+	return res
+}
+
+// GetVersion calls the GetVersion method of the default session, an error is not reported.
+func GetVersion(i int) string {
+	res, _ := DefaultSession().GetVersion(i)
+	return res
+}
+
+// MsgInfo calls the MsgInfo method of the default session.
+func MsgInfo(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().MsgInfo(sMessage, sTitle, fu, sFunc, sName)
+}
+
+// MsgStop calls the MsgStop method of the default session.
+func MsgStop(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().MsgStop(sMessage, sTitle, fu, sFunc, sName)
+}
+
+// MsgYesNo calls the MsgYesNo method of the default session.
+func MsgYesNo(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().MsgYesNo(sMessage, sTitle, fu, sFunc, sName)
+}
+
+// MsgGet calls the MsgGet method of the default session.
+func MsgGet(sMessage string, sTitle string, iStyle int32, fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().MsgGet(sMessage, sTitle, iStyle, fu, sFunc, sName)
+}
+
+// Choice calls the Choice method of the default session.
+func Choice(arr []string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().Choice(arr, sTitle, fu, sFunc, sName)
+}
+
+// SelectFile calls the SelectFile method of the default session.
+func SelectFile(sPath string, fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().SelectFile(sPath, fu, sFunc, sName)
+}
+
+// SelectFolder calls the SelectFolder method of the default session.
+func SelectFolder(fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().SelectFolder(fu, sFunc, sName)
+}
+
+// SelectColor calls the SelectColor method of the default session.
+func SelectColor(iColor int32, fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().SelectColor(iColor, fu, sFunc, sName)
+}
+
+// SelectFont calls the SelectFont method of the default session.
+func SelectFont(fu func([]string) string, sFunc string, sName string) error {
+	return DefaultSession().SelectFont(fu, sFunc, sName)
+}
+
+// InitTray calls the InitTray method of the default session.
+func InitTray(sIcon string, sMenuName string, sTooltip string) error {
+	return DefaultSession().InitTray(sIcon, sMenuName, sTooltip)
+}
+
+// ModifyTrayIcon calls the ModifyTrayIcon method of the default session.
+func ModifyTrayIcon(sIcon string) error {
+	return DefaultSession().ModifyTrayIcon(sIcon)
+}
+
+// SetVar calls the SetVar method of the default session.
+func SetVar(sVarName string, sValue string) error {
+	return DefaultSession().SetVar(sVarName, sValue)
+}
+
+// GetVar calls the GetVar method of the default session, an error is not reported.
+func GetVar(sVarName string) string {
+	res, _ := DefaultSession().GetVar(sVarName)
+	return res
+}
+
+// SetImagePath calls the SetImagePath method of the default session.
+func SetImagePath(sValue string) error {
+	return DefaultSession().SetImagePath(sValue)
+}
+
+// SetPath calls the SetPath method of the default session.
+func SetPath(sValue string) error {
+	return DefaultSession().SetPath(sValue)
+}
+
+// SetDateFormat calls the SetDateFormat method of the default session.
+func SetDateFormat(sValue string) error {
+	return DefaultSession().SetDateFormat(sValue)
+}
+
+// AddMenuFunc calls the AddMenuFunc method of the default session.
+func AddMenuFunc(sName string, id int, fu func(MenuEvent)) {
+	DefaultSession().AddMenuFunc(sName, id, fu)
+}
+
+// AddCheckMenuFunc calls the AddCheckMenuFunc method of the default session.
+func AddCheckMenuFunc(sName string, id int, fu func(MenuEvent)) {
+	DefaultSession().AddCheckMenuFunc(sName, id, fu)
+}
+
+// Caps calls the Caps method of the default session.
+func Caps() Capabilities {
+	return DefaultSession().Caps()
+}
+
+// Supports calls the Supports method of the default session.
+func Supports(sFeature string) bool {
+	return DefaultSession().Supports(sFeature)
+}
+
+// Run calls the Run method of the default session.
+func Run(ctx context.Context) error {
+	return DefaultSession().Run(ctx)
+}
+
+// Wait calls the Wait method of the default session.
+func Wait() {
+	DefaultSession().Wait()
+}
+
+// Post calls the Post method of the default session.
+func Post(fu func()) {
+	DefaultSession().Post(fu)
+}
+
+// AddFuncToIdle calls the AddFuncToIdle method of the default session.
+//
+// Deprecated: use Post.
+func AddFuncToIdle(fu func()) {
+	DefaultSession().AddFuncToIdle(fu)
+}
+
+// Done calls the Done method of the default session.
+func Done() <-chan struct{} {
+	return DefaultSession().Done()
+}
+
+// Err calls the Err method of the default session.
+func Err() error {
+	return DefaultSession().Err()
+}
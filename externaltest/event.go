@@ -0,0 +1,292 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package externaltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// eventTimeout limits waiting for an answer of the program to an event.
+const eventTimeout = 5 * time.Second
+
+// RunProc calls a procedure sName of the program, registered by RegFunc, with parameters
+// aParams, as the GuiServer does it, when a callback with pgo() is executed.
+// It returns, when the program confirms the call; the procedure may be still running then.
+func (srv *Server) RunProc(sName string, aParams ...string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	b, err := srv.event(ctx, "runproc", sName, params(aParams))
+	if err != nil {
+		return err
+	}
+	return checkAnswer(b)
+}
+
+// RunFunc calls a function sName of the program, registered by RegFunc, with parameters
+// aParams, as the GuiServer does it, when a callback with fgo() is executed,
+// and returns its result.
+func (srv *Server) RunFunc(sName string, aParams ...string) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	b, err := srv.event(ctx, "runfunc", sName, params(aParams))
+	if err != nil {
+		return "", err
+	}
+	if err = checkAnswer(b); err != nil {
+		return "", err
+	}
+	var sRes string
+	if err = json.Unmarshal(b, &sRes); err != nil {
+		return "", err
+	}
+	return sRes, nil
+}
+
+// SendEvent sends a message sMsg to the program, as the GuiServer sends events,
+// and returns an answer of the program. The message isn't checked, so a reaction
+// of the program to a malformed or an unknown event may be tested.
+func (srv *Server) SendEvent(sMsg string) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	b, err := srv.send(ctx, []byte(sMsg))
+	return string(b), err
+}
+
+// CloseWindow closes a dialog sName, as a user does it.
+func (srv *Server) CloseWindow(sName string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	b, err := srv.event(ctx, "exit", sName)
+	if err != nil {
+		return err
+	}
+	srv.mux.Lock()
+	srv.delete(sName)
+	srv.mux.Unlock()
+	return checkAnswer(b)
+}
+
+// EndApp closes the application, as a user does it, closing the main window.
+func (srv *Server) EndApp() error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	b, err := srv.event(ctx, "endapp")
+	if err != nil {
+		return err
+	}
+	return checkAnswer(b)
+}
+
+// Fire executes a callback sEvent ("onclick", "onposchanged", etc.) of a widget sName,
+// as the GuiServer does it, when a user acts. aArgs are values of code block parameters:
+// a position for "onposchanged", a column and a row for "onrclick" and "onenter".
+// Only callbacks, set with a function of the program, may be executed,
+// ErrNoCallback is returned for others.
+func (srv *Server) Fire(sName string, sEvent string, aArgs ...string) error {
+
+	o, bOk := srv.Widget(sName)
+	if !bOk {
+		return fmt.Errorf("externaltest: no widget %s", sName)
+	}
+	sCode, bOk := o.Callbacks[sEvent]
+	if !bOk {
+		return fmt.Errorf("%w: %s of %s", ErrNoCallback, sEvent, sName)
+	}
+	return srv.exec(sCode, aArgs)
+}
+
+// ClickMenu selects a menu item with an id iItem of a window or a context menu sName.
+func (srv *Server) ClickMenu(sName string, iItem int) error {
+
+	o, bOk := srv.Widget(sName)
+	if !bOk {
+		return fmt.Errorf("externaltest: no menu of %s", sName)
+	}
+	sCode, bOk := findMenuItem(o.Menu, iItem)
+	if !bOk {
+		return fmt.Errorf("externaltest: no menu item %d in %s", iItem, sName)
+	}
+	if bEnabled, _ := srv.MenuItemState(sName, iItem); !bEnabled {
+		return fmt.Errorf("externaltest: menu item %d of %s is disabled", iItem, sName)
+	}
+	return srv.exec(sCode, nil)
+}
+
+func findMenuItem(aItems []interface{}, iItem int) (string, bool) {
+	for _, x := range aItems {
+		a, _ := x.([]interface{})
+		if len(a) < 2 {
+			continue
+		}
+		if aSub, bOk := a[1].([]interface{}); bOk {
+			if sCode, bOk := findMenuItem(aSub, iItem); bOk {
+				return sCode, true
+			}
+		} else if len(a) > 2 && num(a, 2) == iItem {
+			return str(a, 1), true
+		}
+	}
+	return "", false
+}
+
+// exec executes a callback code sCode, which calls a procedure (pgo) or a function (fgo)
+// of the program.
+func (srv *Server) exec(sCode string, aArgs []string) error {
+
+	sKind, sName, aParams, err := parseCall(sCode, aArgs)
+	if err != nil {
+		return err
+	}
+	if sKind == "fgo" {
+		_, err = srv.RunFunc(sName, aParams...)
+		return err
+	}
+	return srv.RunProc(sName, aParams...)
+}
+
+func params(aParams []string) string {
+	if aParams == nil {
+		aParams = []string{}
+	}
+	b, _ := json.Marshal(aParams)
+	return string(b)
+}
+
+func checkAnswer(b []byte) error {
+	if strings.HasPrefix(string(b), "[\"Err") {
+		return fmt.Errorf("externaltest: the program answers %s", string(b))
+	}
+	return nil
+}
+
+// parseCall parses a Harbour code, which calls a procedure or a function of the program:
+//
+//	{|o,n|pgo("name",{"main.w1",n,"p1"})}  or  fgo("name",{"main.w1"})
+//
+// Code block parameters, except the first one, get values from aArgs.
+func parseCall(sCode string, aArgs []string) (sKind string, sName string, aParams []string, err error) {
+
+	p := &hbParser{s: strings.TrimSpace(sCode), mVars: map[string]string{}}
+	if p.eat("{|") {
+		npos := strings.IndexByte(p.s[p.i:], '|')
+		if npos < 0 {
+			return "", "", nil, p.error()
+		}
+		for i, v := range strings.Split(p.s[p.i:p.i+npos], ",") {
+			if i > 0 && i-1 < len(aArgs) {
+				p.mVars[strings.ToLower(strings.TrimSpace(v))] = aArgs[i-1]
+			}
+		}
+		p.i += npos + 1
+	}
+	if p.eat("pgo(") {
+		sKind = "pgo"
+	} else if p.eat("fgo(") {
+		sKind = "fgo"
+	} else {
+		return "", "", nil, fmt.Errorf("%w: %q doesn't call the program", ErrNoCallback, sCode)
+	}
+	if sName, err = p.str(); err != nil {
+		return
+	}
+	if p.eat(",{") {
+		for !p.eat("}") {
+			if len(aParams) > 0 && !p.eat(",") {
+				return "", "", nil, p.error()
+			}
+			var s string
+			if s, err = p.item(); err != nil {
+				return
+			}
+			aParams = append(aParams, s)
+		}
+	}
+	if !p.eat(")") {
+		return "", "", nil, p.error()
+	}
+	return
+}
+
+type hbParser struct {
+	s     string
+	i     int
+	mVars map[string]string
+}
+
+func (p *hbParser) error() error {
+	return fmt.Errorf("externaltest: can't parse %q at %d", p.s, p.i)
+}
+
+func (p *hbParser) eat(s string) bool {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+	if strings.HasPrefix(p.s[p.i:], s) {
+		p.i += len(s)
+		return true
+	}
+	return false
+}
+
+// item parses a string expression or a code block parameter.
+func (p *hbParser) item() (string, error) {
+	j := p.i
+	for j < len(p.s) && (p.s[j] == '_' || p.s[j] >= 'a' && p.s[j] <= 'z' || p.s[j] >= 'A' && p.s[j] <= 'Z') {
+		j++
+	}
+	if j > p.i {
+		sVar := strings.ToLower(p.s[p.i:j])
+		p.i = j
+		return p.mVars[sVar], nil
+	}
+	return p.str()
+}
+
+// str parses a string expression: literals in "...", '...' or [...], joined with '+', maybe in parentheses.
+func (p *hbParser) str() (string, error) {
+	var sb strings.Builder
+	for {
+		if p.eat("(") {
+			s, err := p.str()
+			if err != nil {
+				return "", err
+			}
+			if !p.eat(")") {
+				return "", p.error()
+			}
+			sb.WriteString(s)
+		} else {
+			if p.i >= len(p.s) {
+				return "", p.error()
+			}
+			cEnd := p.s[p.i]
+			switch cEnd {
+			case '"', '\'':
+			case '[':
+				cEnd = ']'
+			default:
+				return "", p.error()
+			}
+			npos := strings.IndexByte(p.s[p.i+1:], cEnd)
+			if npos < 0 {
+				return "", p.error()
+			}
+			sb.WriteString(p.s[p.i+1 : p.i+1+npos])
+			p.i += npos + 2
+		}
+		if !p.eat("+") {
+			return sb.String(), nil
+		}
+	}
+}
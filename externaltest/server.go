@@ -0,0 +1,293 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package externaltest provides a fake GuiServer for testing programs, which use
+// the external package, without a real GuiServer and a display.
+//
+// A Server keeps a tree of windows and widgets, which a program creates, lets to check it
+// and simulates user actions, sending events to the program:
+//
+//	srv := externaltest.NewServer()
+//	defer srv.Close()
+//	s, err := external.Dial(ctx, srv.Pipe())
+//	...
+//	createForm(s)
+//	srv.Fire("main.btn1", "onclick")
+//	srv.Wait(func() bool { return srv.Text("main.lbl1") == "Pressed" }, time.Second)
+package externaltest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alkresin/external"
+)
+
+// Server is a fake GuiServer. It serves one program connection at a time.
+type Server struct {
+	// Version is a GuiServer version, which is reported to the program, "1.3" by default.
+	// It should be set before the program connects.
+	Version string
+	// Eval, if it isn't nil, returns a result of a Harbour code, passed to EvalFunc.
+	Eval func(sCode string) string
+	// Unsupported lists commands, which are rejected, as an older GuiServer build does:
+	// "set.destroy", for example. It should be set before the program connects.
+	Unsupported []string
+	// ReplyTimeout, if it isn't 0, limits a time, which the program waits for a reply
+	// on a connection, made by Pipe, as Options.ReplyTimeout does for other transports.
+	ReplyTimeout time.Duration
+
+	mux      sync.Mutex
+	mWidg    map[string]*Widget
+	aWnd     []string
+	mVars    map[string]string
+	aMsg     []string
+	sLastWnd string
+
+	lnOut, lnIn net.Listener
+	connIn      net.Conn
+	rdIn        *bufio.Reader
+	chConn      chan struct{}
+	chDone      chan struct{}
+	bDone       bool
+	aConn       []net.Conn
+
+	// muxIn serializes events, sent to the program, and their answers.
+	muxIn sync.Mutex
+}
+
+// NewServer returns a fake GuiServer, which isn't listening yet: call ListenTCP or Pipe
+// to get options for external.Dial.
+func NewServer() *Server {
+	srv := &Server{Version: "1.3", chConn: make(chan struct{}), chDone: make(chan struct{})}
+	srv.reset()
+	return srv
+}
+
+// ListenTCP starts listening on two tcp/ip ports of 127.0.0.1 and returns options
+// for external.Dial.
+func (srv *Server) ListenTCP() (external.Options, error) {
+
+	var err error
+	for i := 0; i < 20; i++ {
+		if srv.lnOut, err = net.Listen("tcp4", "127.0.0.1:0"); err != nil {
+			return external.Options{}, err
+		}
+		iPort := srv.lnOut.Addr().(*net.TCPAddr).Port
+		if srv.lnIn, err = net.Listen("tcp4", "127.0.0.1:"+strconv.Itoa(iPort+1)); err == nil {
+			go srv.accept(srv.lnOut, 0)
+			go srv.accept(srv.lnIn, 1)
+			return external.Options{Address: "127.0.0.1", Port: iPort, Type: external.TypeTCP}, nil
+		}
+		srv.lnOut.Close()
+	}
+	return external.Options{}, err
+}
+
+func (srv *Server) accept(ln net.Listener, iChannel int) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		srv.serve(conn, iChannel)
+	}
+}
+
+// Pipe returns options for external.Dial, which connect the program to the server
+// in-process, via Options.Transport.
+func (srv *Server) Pipe() external.Options {
+	return external.Options{Transport: func(iChannel int) external.Transport {
+		c1, c2 := net.Pipe()
+		srv.serve(c2, iChannel)
+		p := &pipeTransport{conn: c1, rd: bufio.NewReader(c1)}
+		if iChannel == 0 {
+			p.tReply = srv.ReplyTimeout
+		}
+		return p
+	}}
+}
+
+// serve starts serving a connection conn of a channel iChannel: 0 - messages of the program,
+// 1 - events.
+func (srv *Server) serve(conn net.Conn, iChannel int) {
+
+	srv.mux.Lock()
+	srv.aConn = append(srv.aConn, conn)
+	srv.mux.Unlock()
+	go func() {
+		if _, err := conn.Write([]byte("+GuiServer/1.1\n")); err != nil {
+			return
+		}
+		if iChannel == 0 {
+			srv.serveOut(conn)
+			return
+		}
+		srv.mux.Lock()
+		srv.connIn, srv.rdIn = conn, bufio.NewReader(conn)
+		select {
+		case <-srv.chConn:
+		default:
+			close(srv.chConn)
+		}
+		srv.mux.Unlock()
+	}()
+}
+
+// serveOut reads messages of the program and replies to them.
+func (srv *Server) serveOut(conn net.Conn) {
+
+	rd := bufio.NewReader(conn)
+	for {
+		b, err := rd.ReadBytes('\n')
+		if err != nil {
+			srv.finish()
+			return
+		}
+		b = unframe(b)
+		sReply, bExit := srv.handle(b)
+		if bExit {
+			srv.finish()
+			return
+		}
+		if _, err = conn.Write(frame([]byte(sReply))); err != nil {
+			srv.finish()
+			return
+		}
+	}
+}
+
+func (srv *Server) finish() {
+	srv.mux.Lock()
+	if !srv.bDone {
+		srv.bDone = true
+		close(srv.chDone)
+	}
+	srv.mux.Unlock()
+}
+
+// Done returns a channel, which is closed, when the program calls Exit or disconnects.
+func (srv *Server) Done() <-chan struct{} {
+	return srv.chDone
+}
+
+// Close stops listening and closes connections.
+func (srv *Server) Close() error {
+	if srv.lnOut != nil {
+		srv.lnOut.Close()
+		srv.lnIn.Close()
+	}
+	srv.mux.Lock()
+	for _, conn := range srv.aConn {
+		conn.Close()
+	}
+	srv.mux.Unlock()
+	srv.finish()
+	return nil
+}
+
+// Wait checks fu periodically, until it returns true or d passes; it returns the last fu result.
+// Use it to wait for results of callbacks, which may run in other goroutines.
+func (srv *Server) Wait(fu func() bool, d time.Duration) bool {
+	tEnd := time.Now().Add(d)
+	for !fu() {
+		if time.Now().After(tEnd) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
+
+// event sends an event to the program and returns its answer.
+func (srv *Server) event(ctx context.Context, aEvent ...interface{}) ([]byte, error) {
+
+	b, err := marshal(aEvent)
+	if err != nil {
+		return nil, err
+	}
+	return srv.send(ctx, b)
+}
+
+// send sends an event b to the program and returns its answer.
+func (srv *Server) send(ctx context.Context, b []byte) ([]byte, error) {
+
+	select {
+	case <-srv.chConn:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	srv.muxIn.Lock()
+	defer srv.muxIn.Unlock()
+	srv.mux.Lock()
+	conn, rd := srv.connIn, srv.rdIn
+	srv.mux.Unlock()
+	if tDeadline, bOk := ctx.Deadline(); bOk {
+		conn.SetDeadline(tDeadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if _, err := conn.Write(frame(b)); err != nil {
+		return nil, err
+	}
+	b, err := rd.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	return unframe(b), nil
+}
+
+// pipeTransport is an external.Transport over an in-process connection.
+type pipeTransport struct {
+	conn   net.Conn
+	rd     *bufio.Reader
+	tReply time.Duration
+}
+
+func (p *pipeTransport) Dial(ctx context.Context) error {
+	return nil
+}
+
+func (p *pipeTransport) ReadMsg() ([]byte, error) {
+	if p.tReply > 0 {
+		p.conn.SetReadDeadline(time.Now().Add(p.tReply))
+	}
+	b, err := p.rd.ReadBytes('\n')
+	if err != nil {
+		if len(b) == 0 {
+			return nil, err
+		}
+		return nil, fmt.Errorf("externaltest: incomplete message: %w", err)
+	}
+	return unframe(b), nil
+}
+
+func (p *pipeTransport) WriteMsg(b []byte) error {
+	_, err := p.conn.Write(frame(b))
+	return err
+}
+
+func (p *pipeTransport) Close() error {
+	return p.conn.Close()
+}
+
+func frame(b []byte) []byte {
+	buf := make([]byte, 0, len(b)+2)
+	buf = append(buf, '+')
+	buf = append(buf, b...)
+	return append(buf, '\n')
+}
+
+func unframe(b []byte) []byte {
+	return bytes.TrimPrefix(bytes.TrimRight(b, "\r\n"), []byte("+"))
+}
+
+// ErrNoCallback is returned by Fire and ClickMenu, when there is no callback, which may be called.
+var ErrNoCallback = errors.New("externaltest: no callback")
@@ -0,0 +1,261 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package externaltest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+// dial connects a new session to a fake GuiServer srv and creates a main window.
+func dial(t *testing.T, srv *externaltest.Server) (*egui.Session, *egui.Widget) {
+	t.Helper()
+	s, err := egui.Dial(context.Background(), srv.Pipe(),
+		egui.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Exit()
+		srv.Close()
+	})
+	pWnd := &egui.Widget{Title: "Main", W: 400, H: 300}
+	if err := s.InitMainWindow(pWnd); err != nil {
+		t.Fatal(err)
+	}
+	return s, pWnd
+}
+
+// wait waits a result of an event, which the program handles after an answer to it.
+func wait(t *testing.T, ch <-chan []string) []string {
+	t.Helper()
+	select {
+	case ap := <-ch:
+		return ap
+	case <-time.After(time.Second):
+		t.Fatal("the program's function isn't called")
+		return nil
+	}
+}
+
+func TestTree(t *testing.T) {
+	srv := externaltest.NewServer()
+	s, pWnd := dial(t, srv)
+
+	pPnl, err := pWnd.Add(&egui.Widget{Type: "panel", Name: "pnl", X: 10, Y: 20, W: 100, H: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pLbl, _ := pPnl.Add(&egui.Widget{Type: "label", Name: "lbl", Title: "Hi", W: 60, H: 24})
+	pWnd.Add(&egui.Widget{Type: "edit", Name: "edt", Winstyle: 1})
+
+	pDlg := &egui.Widget{Name: "dlg", Title: "Dialog", W: 200, H: 100}
+	if err := s.InitDialog(pDlg); err != nil {
+		t.Fatal(err)
+	}
+	pDlg.Add(&egui.Widget{Type: "button", Name: "btn", Title: "Ok"})
+
+	if a := srv.Windows(); strings.Join(a, ",") != "main,dlg" {
+		t.Errorf("windows %v", a)
+	}
+	o, _ := srv.Widget("main")
+	if o.Type != "main" || o.Text != "Main" || o.W != 400 || o.H != 300 {
+		t.Errorf("main: %+v", o)
+	}
+	if strings.Join(o.Children, ",") != "main.pnl,main.edt" {
+		t.Errorf("main children %v", o.Children)
+	}
+	o, _ = srv.Widget("main.pnl")
+	if o.Type != "panel" || o.X != 10 || o.Y != 20 || o.W != 100 || o.H != 50 {
+		t.Errorf("panel: %+v", o)
+	}
+	if strings.Join(o.Children, ",") != "main.pnl.lbl" {
+		t.Errorf("panel children %v", o.Children)
+	}
+	if o, _ = srv.Widget("main.edt"); o.Props["Winstyle"] != float64(1) {
+		t.Errorf("edit props %v", o.Props)
+	}
+	if o, _ = srv.Widget("dlg.btn"); o.Type != "button" || o.Text != "Ok" {
+		t.Errorf("button: %+v", o)
+	}
+
+	pLbl.SetText("Bye")
+	pLbl.Hide(true)
+	pLbl.Enable(false)
+	pLbl.Move(1, 2, 3, 4)
+	pLbl.SetColor(0xff, -1)
+	o, _ = srv.Widget("main.pnl.lbl")
+	if o.Text != "Bye" || !o.Hidden || !o.Disabled || o.X != 1 || o.Y != 2 || o.W != 3 || o.H != 4 {
+		t.Errorf("label after set: %+v", o)
+	}
+	if o.Params["color"] == nil {
+		t.Errorf("label params %v", o.Params)
+	}
+	if srv.Text("main.pnl.lbl") != "Bye" || pLbl.GetText() != "Bye" {
+		t.Errorf("text %q, %q", srv.Text("main.pnl.lbl"), pLbl.GetText())
+	}
+
+	pDlg.Close()
+	if a := srv.Windows(); strings.Join(a, ",") != "main" {
+		t.Errorf("windows after close %v", a)
+	}
+	if _, bOk := srv.Widget("dlg.btn"); bOk {
+		t.Error("a button of a closed dialog remains")
+	}
+}
+
+func TestMenu(t *testing.T) {
+	srv := externaltest.NewServer()
+	s, pWnd := dial(t, srv)
+
+	ch := make(chan []string, 1)
+	fu := func(ap []string) string {
+		ch <- ap
+		return ""
+	}
+	s.Menu("")
+	s.Menu("File")
+	s.AddMenuItem("Open", 101, fu, "", "open")
+	s.AddMenuSeparator()
+	s.AddCheckMenuItem("Wrap", 102, fu, "", "wrap")
+	s.EndMenu()
+	s.EndMenu()
+	activate(t, srv, pWnd)
+
+	if err := srv.ClickMenu("main", 101); err != nil {
+		t.Fatal(err)
+	}
+	if ap := wait(t, ch); strings.Join(ap, ",") != "menu,open" {
+		t.Errorf("params %v", ap)
+	}
+	if err := srv.ClickMenu("main", 103); err == nil {
+		t.Error("an absent item is clicked")
+	}
+
+	s.MenuItemEnable("main", "", 101, false)
+	s.MenuItemCheck("main", "", 102, true)
+	if bEnabled, bChecked := srv.MenuItemState("main", 101); bEnabled || bChecked {
+		t.Errorf("101: enabled %v, checked %v", bEnabled, bChecked)
+	}
+	if bEnabled, bChecked := srv.MenuItemState("main", 102); !bEnabled || !bChecked {
+		t.Errorf("102: enabled %v, checked %v", bEnabled, bChecked)
+	}
+	if err := srv.ClickMenu("main", 101); err == nil {
+		t.Error("a disabled item is clicked")
+	}
+	if err := srv.ClickMenu("main", 102); err != nil {
+		t.Fatal(err)
+	}
+	if ap := wait(t, ch); strings.Join(ap, ",") != "menu,wrap" {
+		t.Errorf("params %v", ap)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	srv := externaltest.NewServer()
+	s, pWnd := dial(t, srv)
+
+	ch := make(chan []string, 1)
+	s.RegFunc("proc", func(ap []string) string {
+		ch <- ap
+		return ""
+	})
+	s.RegFunc("fnc", func(ap []string) string {
+		return strings.Join(ap, "+")
+	})
+	pBtn, _ := pWnd.Add(&egui.Widget{Type: "button", Name: "btn"})
+	pBtn.SetCallBackProc("onclick", func(ap []string) string {
+		ch <- ap
+		return ""
+	}, "", "p1")
+	activate(t, srv, pWnd)
+
+	if err := srv.RunProc("proc", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if ap := wait(t, ch); strings.Join(ap, ",") != "a,b" {
+		t.Errorf("runproc params %v", ap)
+	}
+	if sRes, err := srv.RunFunc("fnc", "a", "b"); err != nil || sRes != "a+b" {
+		t.Errorf("runfunc: %q, %v", sRes, err)
+	}
+	if _, err := srv.RunFunc("nofnc"); err == nil {
+		t.Error("an unregistered function is called")
+	}
+
+	if err := srv.Fire("main.btn", "onclick"); err != nil {
+		t.Fatal(err)
+	}
+	if ap := wait(t, ch); strings.Join(ap, ",") != "main.btn,p1" {
+		t.Errorf("onclick params %v", ap)
+	}
+	if err := srv.Fire("main.btn", "onsize"); !errors.Is(err, externaltest.ErrNoCallback) {
+		t.Errorf("onsize: %v", err)
+	}
+	if err := srv.Fire("main.nobtn", "onclick"); err == nil {
+		t.Error("an absent widget is fired")
+	}
+}
+
+func TestCloseWindow(t *testing.T) {
+	srv := externaltest.NewServer()
+	s, pWnd := dial(t, srv)
+	pDlg := &egui.Widget{Name: "dlg", Title: "Dialog", W: 200, H: 100}
+	s.InitDialog(pDlg)
+	pDlg.Add(&egui.Widget{Type: "edit", Name: "edt"})
+	activate(t, srv, pWnd)
+	pDlg.Activate()
+
+	if err := srv.CloseWindow("dlg"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Wait(func() bool { return s.Wnd("dlg") == nil }, time.Second) {
+		t.Error("the dialog remains in the program")
+	}
+	if _, bOk := srv.Widget("dlg.edt"); bOk || strings.Join(srv.Windows(), ",") != "main" {
+		t.Errorf("windows %v", srv.Windows())
+	}
+}
+
+func TestEndApp(t *testing.T) {
+	srv := externaltest.NewServer()
+	s, pWnd := dial(t, srv)
+	chAct := make(chan struct{})
+	go func() {
+		pWnd.Activate()
+		close(chAct)
+	}()
+	if !srv.Wait(func() bool { o, _ := srv.Widget("main"); return o.Active }, time.Second) {
+		t.Fatal("the window isn't activated")
+	}
+
+	if err := srv.EndApp(); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []<-chan struct{}{chAct, s.Done(), srv.Done()} {
+		select {
+		case <-ch:
+		case <-time.After(2 * time.Second):
+			t.Fatal("the application doesn't end")
+		}
+	}
+}
+
+// activate activates a main window pWnd, so that the fake GuiServer srv may send events.
+func activate(t *testing.T, srv *externaltest.Server, pWnd *egui.Widget) {
+	t.Helper()
+	go pWnd.Activate()
+	if !srv.Wait(func() bool { o, _ := srv.Widget("main"); return o.Active }, time.Second) {
+		t.Fatal("the window isn't activated")
+	}
+}
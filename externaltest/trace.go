@@ -0,0 +1,32 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package externaltest
+
+import (
+	"encoding/json"
+
+	"github.com/alkresin/external"
+)
+
+// Load applies messages of a program, recorded in a trace aRec (see external.ReadTrace),
+// to the widget tree, as if the program sent them, and closes dialogs, closed by a user.
+// So a state of the GUI at the end of a recorded session, a replayed one also
+// (see external.Replay), may be checked with Widget, Text, etc.
+func (srv *Server) Load(aRec []external.TraceRecord) {
+
+	for _, rec := range aRec {
+		switch rec.Dir {
+		case external.TraceOut:
+			srv.handle([]byte(rec.Msg))
+		case external.TraceEvent:
+			var arr []string
+			if json.Unmarshal([]byte(rec.Msg), &arr) == nil && len(arr) > 1 && arr[0] == "exit" {
+				srv.mux.Lock()
+				srv.delete(arr[1])
+				srv.mux.Unlock()
+			}
+		}
+	}
+}
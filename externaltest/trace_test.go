@@ -0,0 +1,135 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package externaltest_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+// syncBuffer is a log output, which may be read, while it is written.
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+// program creates a form with a button, which changes a text of a label,
+// and activates it; it returns, when the application ends.
+func program(t *testing.T, opts egui.Options, pLog *slog.Logger) {
+	t.Helper()
+	s, err := egui.Dial(context.Background(), opts, egui.WithLogger(pLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pWnd := &egui.Widget{Title: "Main", W: 400, H: 300}
+	s.InitMainWindow(pWnd)
+	pLbl, _ := pWnd.Add(&egui.Widget{Type: "label", Name: "lbl", Title: "Ready", W: 100, H: 24})
+	pBtn, _ := pWnd.Add(&egui.Widget{Type: "button", Name: "btn", Title: "Press", Y: 30, W: 100, H: 24})
+	pBtn.OnClick(func(egui.ClickEvent) { pLbl.SetText("Pressed") })
+	pWnd.Activate()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("the application doesn't end")
+	}
+	s.Exit()
+}
+
+func readTrace(t *testing.T, sPath string) []egui.TraceRecord {
+	t.Helper()
+	f, err := os.Open(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	aRec, err := egui.ReadTrace(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aRec
+}
+
+func TestTraceReplay(t *testing.T) {
+	sDir := t.TempDir()
+	sTrace, sReplayTrace := filepath.Join(sDir, "trace.jsonl"), filepath.Join(sDir, "replay.jsonl")
+	pLog := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// A user's session is recorded.
+	srv := externaltest.NewServer()
+	defer srv.Close()
+	opts := srv.Pipe()
+	opts.Trace = sTrace
+	go func() {
+		if !srv.Wait(func() bool { o, _ := srv.Widget("main"); return o.Active }, 5*time.Second) {
+			t.Error("the window isn't activated")
+			return
+		}
+		if err := srv.Fire("main.btn", "onclick"); err != nil {
+			t.Error(err)
+		}
+		srv.Wait(func() bool { return srv.Text("main.lbl") == "Pressed" }, time.Second)
+		srv.EndApp()
+	}()
+	program(t, opts, pLog)
+	if srv.Text("main.lbl") != "Pressed" {
+		t.Fatalf("label %q", srv.Text("main.lbl"))
+	}
+
+	aRec := readTrace(t, sTrace)
+	mDirs := map[string]bool{}
+	for _, rec := range aRec {
+		mDirs[rec.Dir] = true
+	}
+	for _, sDir := range []string{egui.TraceOut, egui.TraceReply, egui.TraceEvent, egui.TraceAnswer} {
+		if !mDirs[sDir] {
+			t.Errorf("no %s records in the trace", sDir)
+		}
+	}
+
+	// The program is run again with the trace instead of a GuiServer, it is traced also.
+	pOut := &syncBuffer{}
+	program(t, egui.Options{Transport: egui.Replay(aRec, time.Second), Trace: sReplayTrace},
+		slog.New(slog.NewTextHandler(pOut, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	if s := pOut.String(); strings.Contains(s, "replay:") {
+		t.Errorf("the replay differs from the trace:\n%s", s)
+	}
+
+	// Both traces build the same GUI, as the fake server sees it.
+	for i, sPath := range []string{sTrace, sReplayTrace} {
+		srvLoad := externaltest.NewServer()
+		srvLoad.Load(readTrace(t, sPath))
+		for _, sName := range []string{"main", "main.lbl", "main.btn"} {
+			o, _ := srv.Widget(sName)
+			oLoad, bOk := srvLoad.Widget(sName)
+			if !bOk || !reflect.DeepEqual(o, oLoad) {
+				t.Errorf("trace %d: %s is\n%+v\nwant\n%+v", i, sName, oLoad, o)
+			}
+		}
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package externaltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Widget is a window or a widget, created by the program, as the server sees it.
+type Widget struct {
+	Name       string                 // A full name: "main", "main.edit1", "dlg1.panel1.btn1"
+	Type       string                 // "main", "dialog", "menucontext" or a widget type
+	X, Y, W, H int                    // A position and a size
+	Text       string                 // A title or a text, set by SetText
+	Props      map[string]interface{} // Properties, passed on creation: Winstyle, Font, etc.
+	Params     map[string]interface{} // Properties, set later: "color", "font", "xparam.<name>", "brwarr", etc.
+	Callbacks  map[string]string      // Harbour code of callbacks by event names: "onclick", etc.
+	Hidden     bool
+	Disabled   bool
+	Active     bool          // A window is activated
+	Menu       []interface{} // Items of a window menu, as they are sent
+	Children   []string      // Full names of child widgets in order of creation
+
+	mMenuDisabled map[int]bool
+	mMenuChecked  map[int]bool
+}
+
+func (srv *Server) reset() {
+	srv.mWidg = make(map[string]*Widget)
+	srv.aWnd = nil
+	srv.mVars = make(map[string]string)
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// copy returns a copy of a widget, which may be used without locking.
+func (o *Widget) copy() Widget {
+	w := *o
+	w.Props = copyMap(o.Props)
+	w.Params = copyMap(o.Params)
+	w.Callbacks = make(map[string]string, len(o.Callbacks))
+	for k, v := range o.Callbacks {
+		w.Callbacks[k] = v
+	}
+	w.Children = append([]string(nil), o.Children...)
+	w.mMenuDisabled, w.mMenuChecked = nil, nil
+	return w
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	m2 := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		m2[k] = v
+	}
+	return m2
+}
+
+// Widget returns a copy of a window or a widget with a full name sName.
+func (srv *Server) Widget(sName string) (Widget, bool) {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	if o, bOk := srv.mWidg[sName]; bOk {
+		return o.copy(), true
+	}
+	return Widget{}, false
+}
+
+// Text returns a text of a widget with a full name sName or an empty string,
+// if there is no such widget.
+func (srv *Server) Text(sName string) string {
+	o, _ := srv.Widget(sName)
+	return o.Text
+}
+
+// SetText changes a text of a widget, as a user does it.
+func (srv *Server) SetText(sName string, sText string) bool {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	if o, bOk := srv.mWidg[sName]; bOk {
+		o.Text = sText
+		return true
+	}
+	return false
+}
+
+// Windows returns names of opened windows: a main window and dialogs, in order of creation.
+func (srv *Server) Windows() []string {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	return append([]string(nil), srv.aWnd...)
+}
+
+// Var returns a value of a GuiServer variable, set by SetVar.
+func (srv *Server) Var(sName string) string {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	return srv.mVars[sName]
+}
+
+// Messages returns all messages, received from the program, in JSON.
+func (srv *Server) Messages() []string {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	return append([]string(nil), srv.aMsg...)
+}
+
+// MenuItemState returns a state of a menu item with an id iItem of a window
+// or a context menu sName, as it is set by MenuItemEnable and MenuItemCheck.
+func (srv *Server) MenuItemState(sName string, iItem int) (bEnabled bool, bChecked bool) {
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	if o, bOk := srv.mWidg[sName]; bOk {
+		return !o.mMenuDisabled[iItem], o.mMenuChecked[iItem]
+	}
+	return true, false
+}
+
+// handle processes a message b of the program and returns a reply to it;
+// bExit is true, if the program ends.
+func (srv *Server) handle(b []byte) (sReply string, bExit bool) {
+
+	var arr []interface{}
+	if err := json.Unmarshal(b, &arr); err != nil || len(arr) == 0 {
+		return "Err", false
+	}
+	srv.mux.Lock()
+	srv.aMsg = append(srv.aMsg, string(b))
+	srv.mux.Unlock()
+
+	switch arr[0] {
+	case "exit":
+		return "", true
+	case "getver":
+		return srv.getver(arr), false
+	case "evalcode":
+		if len(arr) > 2 && arr[2] == "t" {
+			var sRes string
+			if srv.Eval != nil {
+				sRes = srv.Eval(str(arr, 1))
+			}
+			return jsonString(sRes), false
+		}
+		if srv.Eval != nil {
+			srv.Eval(str(arr, 1))
+		}
+		return "Ok", false
+	case "packet":
+		for _, x := range arr[1:] {
+			if a, bOk := x.([]interface{}); bOk && len(a) > 0 {
+				srv.mux.Lock()
+				srv.apply(a)
+				srv.mux.Unlock()
+			}
+		}
+		return "Ok", false
+	}
+	srv.mux.Lock()
+	defer srv.mux.Unlock()
+	return srv.apply(arr), false
+}
+
+func (srv *Server) getver(arr []interface{}) string {
+	switch num(arr, 1) {
+	case 0:
+		return jsonString(srv.Version)
+	case 1:
+		return jsonString("GuiServer " + srv.Version)
+	}
+	return jsonString("GuiServer " + srv.Version + "\r\nHarbour (externaltest)\r\nHwGUI (externaltest)")
+}
+
+// apply changes the widget tree according to a message arr and returns a reply.
+// srv.mux must be locked.
+func (srv *Server) apply(arr []interface{}) string {
+
+	if srv.unsupported(arr) {
+		return "Err"
+	}
+	switch arr[0] {
+	case "crmainwnd":
+		srv.addWnd("main", "main", arr[1:])
+	case "crdialog":
+		srv.addWnd(str(arr, 1), "dialog", arr[2:])
+	case "addwidg":
+		sName := str(arr, 2)
+		npos := strings.LastIndex(sName, ".")
+		if npos < 0 {
+			return "Err"
+		}
+		pParent := srv.mWidg[sName[:npos]]
+		if pParent == nil {
+			return "Err"
+		}
+		o := newWidget(sName, str(arr, 1), arr[3:])
+		srv.mWidg[sName] = o
+		pParent.Children = append(pParent.Children, sName)
+	case "set":
+		o := srv.mWidg[str(arr, 1)]
+		if o == nil || len(arr) < 4 {
+			return "Err"
+		}
+		srv.set(o, str(arr, 2), arr[3])
+	case "get":
+		o := srv.mWidg[str(arr, 1)]
+		if o == nil {
+			return "Err"
+		}
+		switch sProp := str(arr, 2); sProp {
+		case "text":
+			return jsonString(o.Text)
+		default:
+			b, _ := json.Marshal(o.Params[sProp])
+			return string(b)
+		}
+	case "getvalues":
+		if len(arr) < 3 {
+			return "Err"
+		}
+		aNames, _ := arr[2].([]interface{})
+		aRes := make([]string, len(aNames))
+		for i, x := range aNames {
+			if o := srv.find(str(arr, 1), fmt.Sprint(x)); o != nil {
+				aRes[i] = o.Text
+			}
+		}
+		b, _ := json.Marshal(aRes)
+		return string(b)
+	case "actmainwnd":
+		if o := srv.mWidg["main"]; o != nil {
+			o.Active = true
+		}
+	case "actdialog":
+		if o := srv.mWidg[str(arr, 1)]; o != nil {
+			o.Active = true
+		}
+	case "close":
+		srv.delete(str(arr, 1))
+	case "menu":
+		if len(arr) > 1 {
+			if aItems, bOk := arr[1].([]interface{}); bOk {
+				if o := srv.mWidg[srv.sLastWnd]; o != nil {
+					o.Menu = aItems
+				}
+				break
+			}
+		}
+		// ["menu","enable"|"check",sWndName,sMenuName,iItem,bValue]
+		sName := str(arr, 2)
+		if sName == "" {
+			sName = str(arr, 3)
+		}
+		o := srv.mWidg[sName]
+		if o == nil {
+			o = srv.mWidg[srv.sLastWnd]
+		}
+		if o == nil || len(arr) < 6 {
+			return "Err"
+		}
+		b, _ := arr[5].(bool)
+		if str(arr, 1) == "enable" {
+			o.mMenuDisabled[num(arr, 4)] = !b
+		} else {
+			o.mMenuChecked[num(arr, 4)] = b
+		}
+	case "menucontext":
+		if str(arr, 1) == "create" && len(arr) > 3 {
+			aItems, _ := arr[3].([]interface{})
+			srv.mWidg[str(arr, 2)] = &Widget{Name: str(arr, 2), Type: "menucontext", Menu: aItems,
+				mMenuDisabled: map[int]bool{}, mMenuChecked: map[int]bool{}}
+		}
+	case "setvar":
+		srv.mVars[str(arr, 1)] = str(arr, 2)
+	case "getvar":
+		return jsonString(srv.mVars[str(arr, 1)])
+	}
+	return "Ok"
+}
+
+func newWidget(sName string, sType string, arr []interface{}) *Widget {
+
+	o := &Widget{Name: sName, Type: sType, Props: map[string]interface{}{}, Params: map[string]interface{}{},
+		Callbacks: map[string]string{}, mMenuDisabled: map[int]bool{}, mMenuChecked: map[int]bool{}}
+	if len(arr) > 0 {
+		if aRect, bOk := arr[0].([]interface{}); bOk && len(aRect) >= 5 {
+			o.X, o.Y, o.W, o.H = num(aRect, 0), num(aRect, 1), num(aRect, 2), num(aRect, 3)
+			o.Text = str(aRect, 4)
+		}
+	}
+	if len(arr) > 1 {
+		if mProps, bOk := arr[1].(map[string]interface{}); bOk {
+			o.Props = mProps
+		}
+	}
+	return o
+}
+
+// addWnd adds a main window or a dialog sName, arr contains its position and properties.
+func (srv *Server) addWnd(sName string, sType string, arr []interface{}) {
+	if srv.mWidg[sName] != nil {
+		srv.delete(sName)
+	}
+	srv.mWidg[sName] = newWidget(sName, sType, arr)
+	srv.aWnd = append(srv.aWnd, sName)
+	srv.sLastWnd = sName
+}
+
+// delete removes a window or a widget sName with all its children.
+func (srv *Server) delete(sName string) {
+	o := srv.mWidg[sName]
+	if o == nil {
+		return
+	}
+	for _, sChild := range o.Children {
+		srv.delete(sChild)
+	}
+	delete(srv.mWidg, sName)
+	for i, v := range srv.aWnd {
+		if v == sName {
+			srv.aWnd = append(srv.aWnd[:i], srv.aWnd[i+1:]...)
+			break
+		}
+	}
+	if npos := strings.LastIndex(sName, "."); npos >= 0 {
+		if pParent := srv.mWidg[sName[:npos]]; pParent != nil {
+			for i, v := range pParent.Children {
+				if v == sName {
+					pParent.Children = append(pParent.Children[:i], pParent.Children[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+// find returns a widget sName of a window sWnd, sName is a full name of a widget
+// without a window name, as "getvalues" expects it.
+func (srv *Server) find(sWnd string, sName string) *Widget {
+	return srv.mWidg[sWnd+"."+sName]
+}
+
+// set sets a property sProp of a widget o to a value x.
+func (srv *Server) set(o *Widget, sProp string, x interface{}) {
+
+	switch {
+	case sProp == "text":
+		o.Text = fmt.Sprint(x)
+	case sProp == "hide":
+		o.Hidden, _ = x.(bool)
+	case sProp == "enable":
+		b, _ := x.(bool)
+		o.Disabled = !b
+	case sProp == "move":
+		if a, bOk := x.([]interface{}); bOk && len(a) >= 4 {
+			o.X, o.Y, o.W, o.H = num(a, 0), num(a, 1), num(a, 2), num(a, 3)
+		}
+	case sProp == "setval":
+		// A value is returned by "getvalues" as a text, logical ones as "t" or "f".
+		o.Params[sProp] = x
+		if b, bOk := x.(bool); bOk {
+			x = map[bool]string{true: "t", false: "f"}[b]
+		}
+		o.Text = fmt.Sprint(x)
+	case sProp == "destroy":
+		srv.delete(o.Name)
+	case strings.HasPrefix(sProp, "cb."):
+		o.Callbacks[sProp[3:]] = fmt.Sprint(x)
+	case sProp == "xparam":
+		if a, bOk := x.([]interface{}); bOk && len(a) >= 2 {
+			o.Params["xparam."+str(a, 0)] = a[1]
+		}
+	default:
+		o.Params[sProp] = x
+	}
+}
+
+// str returns arr[i] as a string.
+func str(arr []interface{}, i int) string {
+	if i >= len(arr) || arr[i] == nil {
+		return ""
+	}
+	if s, bOk := arr[i].(string); bOk {
+		return s
+	}
+	return fmt.Sprint(arr[i])
+}
+
+// num returns arr[i] as an int.
+func num(arr []interface{}, i int) int {
+	if i < len(arr) {
+		if f, bOk := arr[i].(float64); bOk {
+			return int(f)
+		}
+	}
+	return 0
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// unsupported reports, whether a command of a message arr is listed in Unsupported.
+func (srv *Server) unsupported(arr []interface{}) bool {
+	sCmd := str(arr, 0)
+	switch sCmd {
+	case "set", "get":
+		sCmd += "." + str(arr, 2)
+	case "common":
+		sCmd += "." + str(arr, 1)
+	}
+	for _, s := range srv.Unsupported {
+		if s == sCmd || s == str(arr, 0) {
+			return true
+		}
+	}
+	return false
+}
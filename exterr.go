@@ -0,0 +1,94 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+var (
+	// ErrNotConnected is returned, when there is no connection to a GuiServer.
+	ErrNotConnected = errors.New("external: no connection to GuiServer")
+	// ErrServerStartFailed is returned, when the GuiServer executable can't be started.
+	ErrServerStartFailed = errors.New("external: GuiServer start failed")
+	// ErrTimeout is returned, when the GuiServer doesn't answer in time.
+	ErrTimeout = errors.New("external: GuiServer reply timeout")
+	// ErrMessageTooLarge is returned, when a message from the GuiServer exceeds Options.MaxMessageSize.
+	ErrMessageTooLarge = errors.New("external: message is too large")
+	// ErrWrongProps is returned, when properties of a widget (Widget.Props or Widget.AProps) are wrong.
+	ErrWrongProps = errors.New("external: wrong widget properties")
+	// ErrWrongType is returned, when a function or a method isn't for a type of a widget.
+	ErrWrongType = errors.New("external: wrong widget type")
+)
+
+// ErrProtocolMismatch is returned, when a protocol version of a GuiServer
+// isn't one of Options.AcceptProtocols.
+type ErrProtocolMismatch struct {
+	Want string // Local protocol versions, Options.AcceptProtocols, separated by commas
+	Got  string // The protocol version of a GuiServer
+}
+
+func (e *ErrProtocolMismatch) Error() string {
+	return fmt.Sprintf("external: protocol version mismatched, need %s, received %s", e.Want, e.Got)
+}
+
+// ErrUnsupported is returned, when the GuiServer doesn't support a feature
+// or a widget type, see Session.Supports.
+type ErrUnsupported struct {
+	Feature string // A feature or a widget type
+	Version string // The GuiServer version
+}
+
+func (e *ErrUnsupported) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("external: \"%s\" isn't known to be supported by GuiServer, see Options.Features", e.Feature)
+	}
+	return fmt.Sprintf("external: \"%s\" isn't supported by GuiServer %s", e.Feature, e.Version)
+}
+
+// ErrServerRejected is returned, when the GuiServer replies with an error to a message.
+type ErrServerRejected struct {
+	Reply string // The raw reply of a GuiServer
+}
+
+func (e *ErrServerRejected) Error() string {
+	return fmt.Sprintf("external: GuiServer rejected a message: %s", e.Reply)
+}
+
+// connError converts a low-level connection error to one of the errors above.
+func connError(err error) error {
+	if errors.Is(err, ErrMessageTooLarge) {
+		return err
+	}
+	var ne net.Error
+	if errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %v", ErrNotConnected, err)
+}
+
+// checkReply returns *ErrServerRejected, if the reply b reports an error.
+func checkReply(b []byte) error {
+	if protocol.IsRejected(b) {
+		return &ErrServerRejected{Reply: string(unframe(b))}
+	}
+	return nil
+}
+
+// unmarshalReply decodes a GuiServer reply b, which may start with '+', to v.
+func unmarshalReply(b []byte, v interface{}) error {
+	if err := protocol.Decode(b, v); err != nil {
+		if errors.Is(err, protocol.ErrRejected) {
+			return checkReply(b)
+		}
+		return err
+	}
+	return nil
+}
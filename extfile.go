@@ -0,0 +1,266 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// The layout of a connection file (TypeFile):
+//
+//	offset 0 - a flag: 1 - the file is written by a program, 2 - by a GuiServer;
+//	offset 1 - a message.
+//
+// A message may be written in two ways:
+//
+//	'+' <message> '\n'                            - a line, as in tcp/ip;
+//	0, <length: 4 bytes, big endian>, <message>   - length-prefixed.
+//
+// ReadMsg recognizes both, WriteMsg uses the way of a last message received,
+// so older GuiServer versions keep working. A file is truncated to the end of a message
+// and the flag is changed after the message is written completely,
+// so the other side never sees a part of a message or bytes of a previous longer one.
+const (
+	fileFlagOwn  = 1
+	fileFlagPeer = 2
+	fileHeadLen  = 6 // flag, marker and length
+)
+
+// fileWatcher waits for changes of a connection file.
+type fileWatcher interface {
+	// Wait returns, when the file may be changed, or when tDeadline (if it isn't zero) is reached.
+	Wait(tDeadline time.Time) error
+	// Reset is called after the program writes to the file: changes, made by it, are skipped,
+	// and a reply of the GuiServer is expected soon.
+	Reset()
+	Close() error
+}
+
+// fileTransport is a Transport via a regular file (TypeFile).
+type fileTransport struct {
+	sFileName string
+	tReply    time.Duration
+	iMaxSize  int
+	f         *os.File
+	pWatch    fileWatcher
+	bClosed   atomic.Bool
+	bLenPref  atomic.Bool
+	bPoll     bool // polling is used instead of system notifications
+	pLog      *slog.Logger
+}
+
+// NewFileTransport returns a Transport, which exchanges messages with a GuiServer
+// via a regular file sPath.
+// tReply and iMaxSize are the same as for NewTCPTransport.
+func NewFileTransport(sPath string, tReply time.Duration, iMaxSize int) Transport {
+	if iMaxSize <= 0 {
+		iMaxSize = DefMaxMessageSize
+	}
+	return &fileTransport{sFileName: sPath, tReply: tReply, iMaxSize: iMaxSize}
+}
+
+// Dial tries to open the file until it succeeds or ctx is done.
+func (p *fileTransport) Dial(ctx context.Context) error {
+
+	var err error
+
+	p.bClosed.Store(false)
+	for {
+		if p.f, err = os.OpenFile(p.sFileName, os.O_RDWR, 0644); err == nil {
+			if p.bPoll {
+				p.pWatch = newPollWatcher()
+			} else {
+				p.pWatch = newFileWatcher(p.sFileName, logOr(p.pLog))
+			}
+			return nil
+		}
+		if sleepCtx(ctx, 250*time.Millisecond) != nil {
+			break
+		}
+	}
+	logOr(p.pLog).Error("can't open a connection file", "file", p.sFileName, "err", err)
+	return err
+}
+
+func (p *fileTransport) setLogger(pLog *slog.Logger) {
+	p.pLog = pLog
+}
+
+// Close closes the file, ReadMsg, waiting for a message, returns net.ErrClosed.
+func (p *fileTransport) Close() error {
+
+	p.bClosed.Store(true)
+	if p.pWatch != nil {
+		p.pWatch.Close()
+	}
+	if p.f != nil {
+		return p.f.Close()
+	}
+	return nil
+}
+
+// ReadMsg waits, until the GuiServer writes a message to the file, and returns it.
+func (p *fileTransport) ReadMsg() ([]byte, error) {
+
+	var tDeadline time.Time
+	if p.tReply > 0 {
+		tDeadline = time.Now().Add(p.tReply)
+	}
+	for !p.bClosed.Load() {
+		b, err := p.readMsg()
+		if err != nil {
+			if p.bClosed.Load() {
+				break
+			}
+			return nil, err
+		}
+		if b != nil {
+			return b, nil
+		}
+		if !tDeadline.IsZero() && time.Now().After(tDeadline) {
+			return nil, os.ErrDeadlineExceeded
+		}
+		if err = p.pWatch.Wait(tDeadline); err != nil && !os.IsTimeout(err) {
+			if p.bClosed.Load() {
+				break
+			}
+			return nil, err
+		}
+	}
+	return nil, net.ErrClosed
+}
+
+// readMsg returns a message, if the file contains it, or nil.
+func (p *fileTransport) readMsg() ([]byte, error) {
+
+	head := make([]byte, fileHeadLen)
+	n, err := p.f.ReadAt(head, 0)
+	if n < 2 || head[0] != fileFlagPeer {
+		if err == io.EOF {
+			err = nil
+		}
+		return nil, err
+	}
+	switch head[1] {
+	case 0:
+		if n < fileHeadLen {
+			return nil, nil
+		}
+		iLen := binary.BigEndian.Uint32(head[2:])
+		if int64(iLen) > int64(p.iMaxSize) {
+			return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrMessageTooLarge, iLen, p.iMaxSize)
+		}
+		b := make([]byte, iLen)
+		if _, err = p.f.ReadAt(b, fileHeadLen); err != nil {
+			return nil, err
+		}
+		p.bLenPref.Store(true)
+		return b, nil
+	case '+':
+	default:
+		return nil, fmt.Errorf("external: wrong message marker %d in %s", head[1], p.sFileName)
+	}
+
+	// A line: '+', a message, '\n'. Bytes of a previous longer message may follow it,
+	// if the GuiServer doesn't truncate the file, so the size of the file isn't the size of the message.
+	fi, err := p.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	iSize := min(fi.Size()-1, int64(p.iMaxSize)+2)
+	b := make([]byte, iSize)
+	n, err = p.f.ReadAt(b, 1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	b = b[:n]
+	if npos := bytes.IndexByte(b, '\n'); npos >= 0 {
+		b = b[:npos+1]
+	} else if fi.Size()-1 > iSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, p.iMaxSize)
+	}
+	p.bLenPref.Store(false)
+	return unframe(b), nil
+}
+
+// WriteMsg writes a message to the file and passes the file to the GuiServer.
+func (p *fileTransport) WriteMsg(b []byte) error {
+
+	var buf []byte
+	if p.bLenPref.Load() {
+		buf = make([]byte, fileHeadLen-1, fileHeadLen-1+len(b))
+		binary.BigEndian.PutUint32(buf[1:], uint32(len(b)))
+		buf = append(buf, b...)
+	} else {
+		buf = frame(b)
+	}
+	if _, err := p.f.WriteAt(buf, 1); err != nil {
+		return err
+	}
+	if err := p.f.Truncate(int64(len(buf) + 1)); err != nil {
+		return err
+	}
+	_, err := p.f.WriteAt([]byte{fileFlagOwn}, 0)
+	p.pWatch.Reset()
+	return err
+}
+
+// Polling intervals: after the program writes to the file a reply is expected soon,
+// then the interval grows, while nothing is changed.
+const (
+	pollMin = 10 * time.Millisecond
+	pollMax = 100 * time.Millisecond
+)
+
+// pollWatcher waits for file changes, checking it periodically.
+// It is used, where a system notification isn't available.
+type pollWatcher struct {
+	d       time.Duration
+	chClose chan struct{}
+	bClosed atomic.Bool
+}
+
+func newPollWatcher() *pollWatcher {
+	return &pollWatcher{d: pollMin, chClose: make(chan struct{})}
+}
+
+func (p *pollWatcher) Wait(tDeadline time.Time) error {
+
+	d := p.d
+	p.d = min(p.d*2, pollMax)
+	if !tDeadline.IsZero() {
+		if dl := time.Until(tDeadline); dl < d {
+			d = dl
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-p.chClose:
+		return net.ErrClosed
+	case <-t.C:
+		return nil
+	}
+}
+
+func (p *pollWatcher) Reset() {
+	p.d = pollMin
+}
+
+func (p *pollWatcher) Close() error {
+	if p.bClosed.CompareAndSwap(false, true) {
+		close(p.chClose)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+)
+
+// inotifyWatcher waits for file changes, using inotify.
+type inotifyWatcher struct {
+	f   *os.File
+	buf []byte
+}
+
+// newFileWatcher returns an inotify based watcher for a file sPath,
+// or a polling one, if inotify isn't available; pLog gets warnings.
+func newFileWatcher(sPath string, pLog *slog.Logger) fileWatcher {
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		pLog.Warn("inotify isn't available, polling is used", "err", err)
+		return newPollWatcher()
+	}
+	if _, err = syscall.InotifyAddWatch(fd, sPath, syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE); err != nil {
+		syscall.Close(fd)
+		pLog.Warn("inotify isn't available, polling is used", "file", sPath, "err", err)
+		return newPollWatcher()
+	}
+	// A non-blocking descriptor is handled by the runtime poller,
+	// so Read supports deadlines and is interrupted by Close.
+	return &inotifyWatcher{f: os.NewFile(uintptr(fd), "inotify"), buf: make([]byte, 4096)}
+}
+
+func (p *inotifyWatcher) Wait(tDeadline time.Time) error {
+	p.f.SetReadDeadline(tDeadline)
+	_, err := p.f.Read(p.buf)
+	return err
+}
+
+// Reset discards events, caused by a write of the program: they are queued already,
+// when the write returns. A change of the GuiServer, discarded with them, isn't lost,
+// because ReadMsg checks the file before waiting.
+func (p *inotifyWatcher) Reset() {
+	p.f.SetReadDeadline(time.Now())
+	for {
+		if _, err := p.f.Read(p.buf); err != nil {
+			break
+		}
+	}
+}
+
+func (p *inotifyWatcher) Close() error {
+	return p.f.Close()
+}
@@ -0,0 +1,14 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package external
+
+import "log/slog"
+
+// newFileWatcher returns a polling watcher, system notifications aren't used here yet.
+func newFileWatcher(sPath string, pLog *slog.Logger) fileWatcher {
+	return newPollWatcher()
+}
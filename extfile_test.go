@@ -0,0 +1,155 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+)
+
+// peerWrite writes a message sMsg to a connection file f, as a GuiServer does it:
+// a line or length-prefixed. If sTail isn't empty, the file isn't truncated
+// and sTail remains after the message, as bytes of a previous longer one.
+func peerWrite(f *os.File, sMsg string, bLenPref bool, sTail string) error {
+	if sTail != "" {
+		if _, err := f.WriteAt([]byte(sTail), 1); err != nil {
+			return err
+		}
+	}
+	var buf []byte
+	if bLenPref {
+		buf = binary.BigEndian.AppendUint32([]byte{0}, uint32(len(sMsg)))
+		buf = append(buf, sMsg...)
+	} else {
+		buf = []byte("+" + sMsg + "\n")
+	}
+	if _, err := f.WriteAt(buf, 1); err != nil {
+		return err
+	}
+	if sTail == "" {
+		if err := f.Truncate(int64(len(buf) + 1)); err != nil {
+			return err
+		}
+	}
+	_, err := f.WriteAt([]byte{2}, 0)
+	return err
+}
+
+// fileContent returns the content of a connection file sPath.
+func fileContent(t *testing.T, sPath string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(sPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFileTransport(t *testing.T) {
+	for _, bPoll := range []bool{false, true} {
+		sPath := filepath.Join(t.TempDir(), "gs.gs")
+		if err := os.WriteFile(sPath, []byte{0}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var p egui.Transport
+		if bPoll {
+			p = egui.NewPollFileTransport(sPath, 500*time.Millisecond, 64)
+		} else {
+			p = egui.NewFileTransport(sPath, 500*time.Millisecond, 64)
+		}
+		if err := p.Dial(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.OpenFile(sPath, os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sLong := strings.Repeat("x", 60)
+		for _, tc := range []struct {
+			sName     string
+			sMsg      string
+			bLenPref  bool
+			sTail     string
+			sWant     string
+			sWantFile string
+		}{
+			{"long line", sLong, false, "", sLong, "\x01+ok\n"},
+			{"short line after long", "hi", false, strings.Repeat("y", 100), "hi", "\x01+ok\n"},
+			{"length-prefixed", "hello", true, "", "hello", "\x01\x00\x00\x00\x00\x02ok"},
+			{"line after length-prefixed", "bye", false, "", "bye", "\x01+ok\n"},
+		} {
+			// The message is written, when ReadMsg waits for it already.
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				if err := peerWrite(f, tc.sMsg, tc.bLenPref, tc.sTail); err != nil {
+					t.Error(err)
+				}
+			}()
+			b, err := p.ReadMsg()
+			if err != nil || string(b) != tc.sWant {
+				t.Errorf("poll %v, %s: %q, %v, want %q", bPoll, tc.sName, b, err, tc.sWant)
+			}
+			if err = p.WriteMsg([]byte("ok")); err != nil {
+				t.Fatal(err)
+			}
+			if b = fileContent(t, sPath); string(b) != tc.sWantFile {
+				t.Errorf("poll %v, %s: the file %q, want %q", bPoll, tc.sName, b, tc.sWantFile)
+			}
+		}
+
+		for _, tc := range []struct {
+			sName    string
+			sMsg     string
+			bLenPref bool
+		}{
+			{"too long line", strings.Repeat("x", 65), false},
+			{"too long length-prefixed", strings.Repeat("x", 65), true},
+		} {
+			if err := peerWrite(f, tc.sMsg, tc.bLenPref, ""); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.ReadMsg(); !errors.Is(err, egui.ErrMessageTooLarge) {
+				t.Errorf("poll %v, %s: %v", bPoll, tc.sName, err)
+			}
+		}
+
+		f.WriteAt([]byte{2, '?'}, 0)
+		if _, err := p.ReadMsg(); err == nil || errors.Is(err, egui.ErrMessageTooLarge) {
+			t.Errorf("poll %v, wrong marker: %v", bPoll, err)
+		}
+		f.WriteAt([]byte{1}, 0)
+		tStart := time.Now()
+		if _, err := p.ReadMsg(); !errors.Is(err, os.ErrDeadlineExceeded) || time.Since(tStart) < 500*time.Millisecond {
+			t.Errorf("poll %v, no message: %v in %v", bPoll, err, time.Since(tStart))
+		}
+		f.Close()
+		p.Close()
+	}
+}
+
+func TestFileTransportClose(t *testing.T) {
+	sPath := filepath.Join(t.TempDir(), "gs.gs")
+	os.WriteFile(sPath, []byte{0}, 0644)
+	p := egui.NewPollFileTransport(sPath, 0, 0)
+	if err := p.Dial(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p.Close()
+	}()
+	if _, err := p.ReadMsg(); err == nil {
+		t.Error("ReadMsg isn't interrupted by Close")
+	}
+}
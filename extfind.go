@@ -0,0 +1,85 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"path"
+	"strings"
+)
+
+// register adds a window or a widget o to the registry of the session, which is keyed
+// by full names ("main.panel1.edit1"). s.mux must be locked.
+func (s *Session) register(o *Widget) {
+	if s.mWidg == nil {
+		s.mWidg = make(map[string]*Widget)
+	}
+	s.mWidg[widgFullName(o)] = o
+}
+
+// forget removes a window or a widget o and its children from the registry. s.mux must be locked.
+func (s *Session) forget(o *Widget) {
+	sName := widgFullName(o)
+	if s.mWidg[sName] == o {
+		delete(s.mWidg, sName)
+	}
+	for _, oChild := range o.aWidgets {
+		s.forget(oChild)
+	}
+}
+
+// Select returns a function for FindAll, which matches widgets by a selector sSel:
+// a widget type ("edit"), a name pattern after '#' ("#edi*", see path.Match) or both ("edit#edi*").
+// An empty selector matches all widgets.
+func Select(sSel string) func(*Widget) bool {
+	sType, sPattern, _ := strings.Cut(sSel, "#")
+	return func(o *Widget) bool {
+		if sType != "" && o.Type != sType {
+			return false
+		}
+		if sPattern != "" {
+			if bOk, _ := path.Match(sPattern, o.Name); !bOk {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Find returns the first widget inside a window or a widget root (children first, then
+// their children), which matches a selector sSel (see Select), or nil.
+func Find(root *Widget, sSel string) *Widget {
+	fu := Select(sSel)
+	for _, o := range root.descendants() {
+		if fu(o) {
+			return o
+		}
+	}
+	return nil
+}
+
+// FindAll returns all widgets inside a window or a widget root, for which fu returns true:
+//
+//	aEdits := egui.FindAll(pPanel, egui.Select("edit"))
+func FindAll(root *Widget, fu func(*Widget) bool) []*Widget {
+	var aRes []*Widget
+	for _, o := range root.descendants() {
+		if fu(o) {
+			aRes = append(aRes, o)
+		}
+	}
+	return aRes
+}
+
+// descendants returns all widgets inside o, level by level.
+func (o *Widget) descendants() []*Widget {
+	s := o.session()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	aRes := append([]*Widget{}, o.aWidgets...)
+	for i := 0; i < len(aRes); i++ {
+		aRes = append(aRes, aRes[i].aWidgets...)
+	}
+	return aRes
+}
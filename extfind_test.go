@@ -0,0 +1,78 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"strings"
+	"testing"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+// names returns full names of widgets, as the GuiServer knows them.
+func names(aWidg []*egui.Widget) string {
+	aNames := make([]string, len(aWidg))
+	for i, o := range aWidg {
+		aNames[i] = o.Name
+		for p := o.Parent; p != nil; p = p.Parent {
+			aNames[i] = p.Name + "." + aNames[i]
+		}
+	}
+	return strings.Join(aNames, ",")
+}
+
+func TestFind(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pWnd := mainWindow(t, s)
+	pPnl, _ := pWnd.Add(&egui.Widget{Type: "panel", Name: "pnl"})
+	pPnl.Add(&egui.Widget{Type: "edit", Name: "edtName"})
+	pPnl.Add(&egui.Widget{Type: "label", Name: "lblName"})
+	pWnd.Add(&egui.Widget{Type: "edit", Name: "edtAge"})
+	pWnd.Add(&egui.Widget{Type: "button", Name: "btnOk"})
+	pSub, _ := pPnl.Add(&egui.Widget{Type: "panel", Name: "sub"})
+	pSub.Add(&egui.Widget{Type: "edit", Name: "edtNote"})
+
+	for _, tc := range []struct {
+		root  *egui.Widget
+		sSel  string
+		sAll  string
+		sFind string
+	}{
+		{pWnd, "", "main.pnl,main.edtAge,main.btnOk,main.pnl.edtName,main.pnl.lblName,main.pnl.sub,main.pnl.sub.edtNote", "main.pnl"},
+		{pWnd, "edit", "main.edtAge,main.pnl.edtName,main.pnl.sub.edtNote", "main.edtAge"},
+		{pWnd, "#*Name", "main.pnl.edtName,main.pnl.lblName", "main.pnl.edtName"},
+		{pWnd, "edit#edtN*", "main.pnl.edtName,main.pnl.sub.edtNote", "main.pnl.edtName"},
+		{pWnd, "label#edt*", "", ""},
+		{pWnd, "#[", "", ""},
+		{pPnl, "edit", "main.pnl.edtName,main.pnl.sub.edtNote", "main.pnl.edtName"},
+		{pPnl, "button", "", ""},
+		{pSub, "", "main.pnl.sub.edtNote", "main.pnl.sub.edtNote"},
+	} {
+		aAll := egui.FindAll(tc.root, egui.Select(tc.sSel))
+		if s := names(aAll); s != tc.sAll {
+			t.Errorf("FindAll(%s, %q): %s, want %s", tc.root.Name, tc.sSel, s, tc.sAll)
+		}
+		var sFind string
+		if o := egui.Find(tc.root, tc.sSel); o != nil {
+			sFind = names([]*egui.Widget{o})
+		}
+		if sFind != tc.sFind {
+			t.Errorf("Find(%s, %q): %s, want %s", tc.root.Name, tc.sSel, sFind, tc.sFind)
+		}
+		// Found widgets are the ones, which the GuiServer has.
+		for _, sName := range strings.Split(tc.sAll, ",") {
+			if _, bOk := srv.Widget(sName); sName != "" && !bOk {
+				t.Errorf("%s isn't on the server", sName)
+			}
+		}
+	}
+
+	pSub.Destroy()
+	if s := names(egui.FindAll(pWnd, egui.Select("edit"))); s != "main.edtAge,main.pnl.edtName" {
+		t.Errorf("FindAll after Destroy: %s", s)
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// Layout computes positions and sizes of widgets, so that X, Y, W and H needn't be set by hand.
+// Layouts are VBox, HBox, Grid and Form, they may be nested. A layout is applied to a window
+// or a widget by SetLayout:
+//
+//	pBox := egui.VBox()
+//	pBox.Padding = 8
+//	pWnd.SetLayout(pBox.
+//		Add(pEdit, 1).
+//		AddLayout(egui.HBox().AddSpace(0, 1).Add(pBtnOk, 0).Add(pBtnCancel, 0), 0))
+//
+// W and H of widgets are their preferred sizes. A widget, which W (or H) is 0,
+// fills a cell of a layout in this direction.
+type Layout interface {
+	// Size returns a preferred size of a layout.
+	Size() (int, int)
+	// arrange sets positions and sizes of widgets of a layout in a rectangle.
+	arrange(x, y, w, h int)
+	// widgets appends widgets of a layout and nested layouts to a.
+	widgets(a []*Widget) []*Widget
+}
+
+// layoutItem is a widget, a nested layout or an empty space in a layout.
+type layoutItem struct {
+	pWidg    *Widget
+	pLayout  Layout
+	w, h     int // a preferred size of a widget or a size of an empty space
+	iStretch int
+}
+
+func newItem(pWidg *Widget, iStretch int) layoutItem {
+	it := layoutItem{pWidg: pWidg, iStretch: iStretch}
+	if pWidg != nil {
+		it.w, it.h = pWidg.W, pWidg.H
+	}
+	return it
+}
+
+func (it *layoutItem) size() (int, int) {
+	if it.pLayout != nil {
+		return it.pLayout.Size()
+	}
+	return it.w, it.h
+}
+
+// arrange places an item in a cell; a widget keeps its preferred size, if it isn't 0
+// and the cell isn't smaller, or fills the cell, if bFillW (bFillH) is true.
+func (it *layoutItem) arrange(x, y, w, h int, bFillW, bFillH bool) {
+	if it.pLayout != nil {
+		it.pLayout.arrange(x, y, w, h)
+	} else if it.pWidg != nil {
+		it.pWidg.X, it.pWidg.Y, it.pWidg.W, it.pWidg.H = x, y, it.w, it.h
+		if bFillW || it.w == 0 || it.w > w {
+			it.pWidg.W = w
+		}
+		if bFillH || it.h == 0 || it.h > h {
+			it.pWidg.H = h
+		}
+	}
+}
+
+func (it *layoutItem) widgets(a []*Widget) []*Widget {
+	if it.pWidg != nil {
+		return append(a, it.pWidg)
+	} else if it.pLayout != nil {
+		return it.pLayout.widgets(a)
+	}
+	return a
+}
+
+// Box arranges items in a column (VBox) or in a row (HBox).
+// Extra space is shared between items according to their stretch factors.
+type Box struct {
+	Padding int // A space around items, 0 by default, it is needed for an outer layout usually
+	Spacing int // A space between items, 8 by default
+	bVert   bool
+	aItems  []layoutItem
+}
+
+// VBox returns a layout, which arranges items from top to bottom.
+func VBox() *Box {
+	return &Box{bVert: true, Spacing: 8}
+}
+
+// HBox returns a layout, which arranges items from left to right.
+func HBox() *Box {
+	return &Box{Spacing: 8}
+}
+
+// Add adds a widget pWidg to a box, iStretch is its share of extra space, 0 - it keeps its size;
+// a negative iStretch is the same as 0.
+func (b *Box) Add(pWidg *Widget, iStretch int) *Box {
+	b.aItems = append(b.aItems, newItem(pWidg, iStretch))
+	return b
+}
+
+// AddLayout adds a nested layout l to a box, iStretch is its share of extra space.
+func (b *Box) AddLayout(l Layout, iStretch int) *Box {
+	b.aItems = append(b.aItems, layoutItem{pLayout: l, iStretch: iStretch})
+	return b
+}
+
+// AddSpace adds an empty space of a size iSize to a box, iStretch is its share of extra space.
+func (b *Box) AddSpace(iSize int, iStretch int) *Box {
+	b.aItems = append(b.aItems, layoutItem{w: iSize, h: iSize, iStretch: iStretch})
+	return b
+}
+
+// Size returns a preferred size of a box.
+func (b *Box) Size() (int, int) {
+	var iMain, iCross int
+	for i := range b.aItems {
+		w, h := b.aItems[i].size()
+		if b.bVert {
+			w, h = h, w
+		}
+		iMain += w
+		iCross = max(iCross, h)
+	}
+	if len(b.aItems) > 1 {
+		iMain += b.Spacing * (len(b.aItems) - 1)
+	}
+	iMain += 2 * b.Padding
+	iCross += 2 * b.Padding
+	if b.bVert {
+		return iCross, iMain
+	}
+	return iMain, iCross
+}
+
+func (b *Box) arrange(x, y, w, h int) {
+	x, y, w, h = x+b.Padding, y+b.Padding, w-2*b.Padding, h-2*b.Padding
+	iMain, iCross := w, h
+	if b.bVert {
+		iMain, iCross = h, w
+	}
+	aSizes := make([]int, len(b.aItems))
+	for i := range b.aItems {
+		w, h := b.aItems[i].size()
+		if b.bVert {
+			aSizes[i] = h
+		} else {
+			aSizes[i] = w
+		}
+		iMain -= aSizes[i]
+	}
+	if len(b.aItems) > 1 {
+		iMain -= b.Spacing * (len(b.aItems) - 1)
+	}
+	aSizes = share(aSizes, b.aItems, iMain)
+
+	iPos := 0
+	for i := range b.aItems {
+		if b.bVert {
+			b.aItems[i].arrange(x, y+iPos, iCross, aSizes[i], false, b.aItems[i].iStretch > 0)
+		} else {
+			b.aItems[i].arrange(x+iPos, y, aSizes[i], iCross, b.aItems[i].iStretch > 0, false)
+		}
+		iPos += aSizes[i] + b.Spacing
+	}
+}
+
+func (b *Box) widgets(a []*Widget) []*Widget {
+	for i := range b.aItems {
+		a = b.aItems[i].widgets(a)
+	}
+	return a
+}
+
+// share adds an extra space iExtra to sizes aSizes of items according to their stretch factors,
+// the last stretched item gets a remainder. Stretch factors, which are less than 1, are ignored.
+func share(aSizes []int, aItems []layoutItem, iExtra int) []int {
+	var iStretch int
+	for i := range aItems {
+		iStretch += max(aItems[i].iStretch, 0)
+	}
+	if iExtra <= 0 || iStretch == 0 {
+		return aSizes
+	}
+	iRest := iExtra
+	iLast := -1
+	for i := range aItems {
+		if aItems[i].iStretch > 0 {
+			n := iExtra * aItems[i].iStretch / iStretch
+			aSizes[i] += n
+			iRest -= n
+			iLast = i
+		}
+	}
+	aSizes[iLast] += iRest
+	return aSizes
+}
+
+// Grid arranges items in a table with a fixed number of columns, row by row.
+// A width of a column is a maximal preferred width of its items, a height of a row -
+// a maximal preferred height; extra width is shared between columns with stretch factors.
+type Grid struct {
+	Padding  int // A space around items, 0 by default
+	HSpacing int // A space between columns, 8 by default
+	VSpacing int // A space between rows, 8 by default
+	iCols    int
+	aItems   []layoutItem
+	aStretch []int
+}
+
+// NewGrid returns a grid layout with iCols columns.
+func NewGrid(iCols int) *Grid {
+	iCols = max(iCols, 1)
+	return &Grid{iCols: iCols, aStretch: make([]int, iCols), HSpacing: 8, VSpacing: 8}
+}
+
+// Add adds a widget pWidg to a next cell of a grid, nil leaves the cell empty.
+func (g *Grid) Add(pWidg *Widget) *Grid {
+	g.aItems = append(g.aItems, newItem(pWidg, 0))
+	return g
+}
+
+// AddLayout adds a nested layout l to a next cell of a grid.
+func (g *Grid) AddLayout(l Layout) *Grid {
+	g.aItems = append(g.aItems, layoutItem{pLayout: l})
+	return g
+}
+
+// SetStretch sets a stretch factor iStretch of a column iCol, 0 by default.
+func (g *Grid) SetStretch(iCol int, iStretch int) *Grid {
+	if iCol >= 0 && iCol < g.iCols {
+		g.aStretch[iCol] = iStretch
+	}
+	return g
+}
+
+// sizes returns preferred widths of columns and heights of rows.
+func (g *Grid) sizes() ([]int, []int) {
+	aWidths := make([]int, g.iCols)
+	aHeights := make([]int, (len(g.aItems)+g.iCols-1)/g.iCols)
+	for i := range g.aItems {
+		w, h := g.aItems[i].size()
+		aWidths[i%g.iCols] = max(aWidths[i%g.iCols], w)
+		aHeights[i/g.iCols] = max(aHeights[i/g.iCols], h)
+	}
+	return aWidths, aHeights
+}
+
+// Size returns a preferred size of a grid.
+func (g *Grid) Size() (int, int) {
+	aWidths, aHeights := g.sizes()
+	return sum(aWidths, g.HSpacing) + 2*g.Padding, sum(aHeights, g.VSpacing) + 2*g.Padding
+}
+
+func (g *Grid) arrange(x, y, w, h int) {
+	aWidths, aHeights := g.sizes()
+	aCols := make([]layoutItem, g.iCols)
+	for i := range aCols {
+		aCols[i].iStretch = g.aStretch[i]
+	}
+	aWidths = share(aWidths, aCols, w-2*g.Padding-sum(aWidths, g.HSpacing))
+
+	y += g.Padding
+	for iRow, iHeight := range aHeights {
+		xCell := x + g.Padding
+		for iCol, iWidth := range aWidths {
+			if i := iRow*g.iCols + iCol; i < len(g.aItems) {
+				g.aItems[i].arrange(xCell, y, iWidth, iHeight, false, false)
+			}
+			xCell += iWidth + g.HSpacing
+		}
+		y += iHeight + g.VSpacing
+	}
+}
+
+func (g *Grid) widgets(a []*Widget) []*Widget {
+	for i := range g.aItems {
+		a = g.aItems[i].widgets(a)
+	}
+	return a
+}
+
+// sum returns a sum of sizes a with spaces iSpacing between them.
+func sum(a []int, iSpacing int) int {
+	n := 0
+	for _, v := range a {
+		n += v
+	}
+	if len(a) > 1 {
+		n += iSpacing * (len(a) - 1)
+	}
+	return n
+}
+
+// Form is a grid of two columns: labels and fields, the column of fields is stretched.
+// It is convenient for data-entry dialogs:
+//
+//	pForm := egui.NewForm().AddRow(pLblName, pEdiName).AddRow(pLblDate, pEdiDate)
+type Form struct {
+	Grid
+}
+
+// NewForm returns a form layout.
+func NewForm() *Form {
+	f := &Form{Grid: *NewGrid(2)}
+	f.SetStretch(1, 1)
+	return f
+}
+
+// AddRow adds a row with a label pLabel and a field pField; pLabel may be nil.
+func (f *Form) AddRow(pLabel *Widget, pField *Widget) *Form {
+	f.Add(pLabel)
+	f.Add(pField)
+	return f
+}
+
+// SetLayout arranges widgets of a layout l in a window or a widget o: widgets, which aren't
+// added yet, are added to o, others are moved. If o is a window, the layout is applied again,
+// when the window is resized, so its "onsize" callback is occupied.
+// Widgets, which are added, get anchors (if their Anchor is 0), computed by the layout,
+// so they follow a resized container, which isn't a window, too.
+func (o *Widget) SetLayout(l Layout) error {
+	w, h := l.Size()
+	o.pLayout = l
+	if err := o.applyLayout(max(w, o.W), max(h, o.H)); err != nil {
+		return err
+	}
+	if o.Type == "main" || o.Type == "dialog" {
+		return o.OnSize(func(ev SizeEvent) {
+			if ev.Width > 0 && ev.Height > 0 {
+				o.applyLayout(ev.Width, ev.Height)
+			}
+		})
+	}
+	return nil
+}
+
+// applyLayout arranges widgets of a layout of o in a rectangle of a size w, h.
+// Moves of widgets are sent in one packet.
+func (o *Widget) applyLayout(w, h int) error {
+	s := o.session()
+	l := o.pLayout
+	aWidgs := l.widgets(nil)
+	aOld := make([]protocol.Rect, len(aWidgs))
+	var bAnchors bool
+	for i, pWidg := range aWidgs {
+		aOld[i] = widgRect(pWidg)
+		bAnchors = bAnchors || (pWidg.Parent == nil && pWidg.Anchor == 0)
+	}
+	// To compute anchors the layout is arranged in a larger rectangle at first
+	var aLarge []protocol.Rect
+	if bAnchors {
+		l.arrange(0, 0, w+iProbe, h+iProbe)
+		for _, pWidg := range aWidgs {
+			aLarge = append(aLarge, widgRect(pWidg))
+		}
+	}
+	l.arrange(0, 0, w, h)
+
+	var aMove []protocol.Msg
+	for i, pWidg := range aWidgs {
+		if pWidg.Parent == nil {
+			if pWidg.Anchor == 0 && aLarge != nil {
+				pWidg.Anchor = anchor(widgRect(pWidg), aLarge[i])
+			}
+			if _, err := o.Add(pWidg); err != nil {
+				return err
+			}
+		} else if widgRect(pWidg) != aOld[i] {
+			sName := widgFullName(pWidg)
+			sParams := protocol.Set{Name: sName, Prop: "move",
+				Value: []int32{int32(pWidg.X), int32(pWidg.Y), int32(pWidg.W), int32(pWidg.H)}}
+			s.record(pWidg, sName+".move", sParams)
+			aMove = append(aMove, sParams)
+		}
+	}
+	if len(aMove) == 0 {
+		return nil
+	}
+	return s.sendPacket(aMove)
+}
+
+// iProbe is an increase of a container size, which is used to compute anchors.
+const iProbe = 1000
+
+// anchor returns an anchor of a widget, which has a rectangle r in a container and
+// a rectangle rLarge, when the container is larger by iProbe in both directions.
+func anchor(r, rLarge protocol.Rect) int32 {
+	return anchorDir(rLarge.X-r.X, rLarge.W-r.W, A_LEFTABS, A_RIGHTABS, A_LEFTREL|A_RIGHTREL, A_HORFIX) |
+		anchorDir(rLarge.Y-r.Y, rLarge.H-r.H, A_TOPABS, A_BOTTOMABS, A_TOPREL|A_BOTTOMREL, A_VERTFIX)
+}
+
+// anchorDir returns anchor flags for one direction by a shift dPos and a growth dSize of a widget:
+// iStart - it stays at the start, iEnd - at the end, iRel - it is stretched proportionally,
+// iFix - it is moved, keeping its size.
+func anchorDir(dPos, dSize int, iStart, iEnd, iRel, iFix int32) int32 {
+	switch {
+	case dSize == 0 && dPos == 0:
+		return iStart
+	case dSize == 0 && dPos == iProbe:
+		return iEnd
+	case dSize == 0:
+		return iFix
+	case dPos == 0 && dSize == iProbe:
+		return iStart | iEnd
+	}
+	return iRel
+}
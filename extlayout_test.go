@@ -0,0 +1,157 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+func TestShare(t *testing.T) {
+	for _, tc := range []struct {
+		aSizes   []int
+		aStretch []int
+		iExtra   int
+		aWant    []int
+	}{
+		{[]int{10, 20}, []int{0, 0}, 30, []int{10, 20}},
+		{[]int{10, 20}, []int{1, 0}, 30, []int{40, 20}},
+		{[]int{10, 20}, []int{1, 1}, 30, []int{25, 35}},
+		{[]int{0, 0, 0}, []int{1, 1, 1}, 10, []int{3, 3, 4}},
+		{[]int{0, 0}, []int{1, 2}, 10, []int{3, 7}},
+		{[]int{10, 20}, []int{1, 1}, 0, []int{10, 20}},
+		{[]int{10, 20}, []int{1, 1}, -5, []int{10, 20}},
+		// Negative stretch factors are ignored
+		{[]int{10, 20}, []int{-1, 0}, 30, []int{10, 20}},
+		{[]int{10, 20}, []int{-1, 1}, 30, []int{10, 50}},
+		{[]int{10, 20}, []int{2, -1}, 30, []int{40, 20}},
+		{nil, nil, 30, nil},
+	} {
+		aSizes := append([]int(nil), tc.aSizes...)
+		aRes := egui.Share(aSizes, tc.aStretch, tc.iExtra)
+		if fmt.Sprint(aRes) != fmt.Sprint(tc.aWant) {
+			t.Errorf("share(%v, %v, %d) = %v, want %v", tc.aSizes, tc.aStretch, tc.iExtra, aRes, tc.aWant)
+		}
+	}
+}
+
+// rect returns a position and a size of a widget as a string.
+func rect(p *egui.Widget) string {
+	return fmt.Sprintf("%d,%d,%d,%d", p.X, p.Y, p.W, p.H)
+}
+
+func TestLayouts(t *testing.T) {
+	w := func(iW, iH int) *egui.Widget {
+		return &egui.Widget{W: iW, H: iH}
+	}
+	for _, tc := range []struct {
+		sName  string
+		mk     func(a []*egui.Widget) egui.Layout
+		aWidgs []*egui.Widget
+		iW, iH int
+		sSize  string   // a preferred size of a layout
+		aRects []string // rectangles of widgets in iW x iH
+	}{
+		{"vbox", func(a []*egui.Widget) egui.Layout {
+			b := egui.VBox()
+			b.Padding = 5
+			return b.Add(a[0], 0).Add(a[1], 1).Add(a[2], 0)
+		}, []*egui.Widget{w(100, 20), w(0, 50), w(80, 20)}, 200, 200,
+			"110,116", []string{"5,5,100,20", "5,33,190,134", "5,175,80,20"}},
+		{"hbox with a space", func(a []*egui.Widget) egui.Layout {
+			return egui.HBox().AddSpace(0, 1).Add(a[0], 0).Add(a[1], 0)
+		}, []*egui.Widget{w(80, 28), w(80, 28)}, 300, 40,
+			"176,28", []string{"132,0,80,28", "220,0,80,28"}},
+		{"hbox, a widget is larger, than a box", func(a []*egui.Widget) egui.Layout {
+			return egui.HBox().Add(a[0], 0)
+		}, []*egui.Widget{w(80, 50)}, 60, 40,
+			"80,50", []string{"0,0,80,40"}},
+		{"grid", func(a []*egui.Widget) egui.Layout {
+			g := egui.NewGrid(2)
+			g.Padding = 10
+			return g.Add(a[0]).Add(a[1]).Add(nil).Add(a[2]).SetStretch(0, 1)
+		}, []*egui.Widget{w(40, 20), w(0, 30), w(100, 20)}, 200, 100,
+			"168,78", []string{"10,10,40,20", "90,10,100,30", "90,48,100,20"}},
+		{"grid with more cells, than widgets", func(a []*egui.Widget) egui.Layout {
+			return egui.NewGrid(3).Add(a[0]).Add(a[1]).Add(a[2]).Add(a[3])
+		}, []*egui.Widget{w(10, 10), w(20, 10), w(30, 10), w(40, 20)}, 120, 40,
+			"106,38", []string{"0,0,10,10", "48,0,20,10", "76,0,30,10", "0,18,40,20"}},
+		{"form", func(a []*egui.Widget) egui.Layout {
+			return egui.NewForm().AddRow(a[0], a[1]).AddRow(a[2], a[3])
+		}, []*egui.Widget{w(60, 24), w(0, 24), w(40, 24), w(100, 24)}, 300, 100,
+			"168,56", []string{"0,0,60,24", "68,0,232,24", "0,32,40,24", "68,32,100,24"}},
+		{"nested", func(a []*egui.Widget) egui.Layout {
+			b := egui.VBox()
+			b.Padding = 8
+			return b.AddLayout(egui.NewForm().AddRow(a[0], a[1]), 1).
+				AddLayout(egui.HBox().AddSpace(0, 1).Add(a[2], 0), 0)
+		}, []*egui.Widget{w(60, 24), w(0, 24), w(80, 28)}, 400, 300,
+			"104,76", []string{"8,8,60,24", "76,8,316,24", "312,264,80,28"}},
+	} {
+		t.Run(tc.sName, func(t *testing.T) {
+			l := tc.mk(tc.aWidgs)
+			iW, iH := l.Size()
+			if s := fmt.Sprintf("%d,%d", iW, iH); s != tc.sSize {
+				t.Errorf("size %s, want %s", s, tc.sSize)
+			}
+			egui.Arrange(l, 0, 0, tc.iW, tc.iH)
+			for i, p := range tc.aWidgs {
+				if s := rect(p); s != tc.aRects[i] {
+					t.Errorf("widget %d: %s, want %s", i, s, tc.aRects[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSetLayout(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pWnd := mainWindow(t, s)
+	pEdit := &egui.Widget{Type: "edit", Name: "e", H: 24}
+	pBtn := &egui.Widget{Type: "button", Name: "b", W: 80, H: 28}
+	b := egui.VBox()
+	b.Padding = 8
+	if err := pWnd.SetLayout(b.Add(pEdit, 0).AddLayout(egui.HBox().AddSpace(0, 1).Add(pBtn, 0), 1)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		sName, sRect string
+		iAnchor      int32
+	}{
+		{"main.e", "8,8,384,24", egui.A_TOPABS | egui.A_LEFTABS | egui.A_RIGHTABS},
+		{"main.b", "312,40,80,28", egui.A_TOPABS | egui.A_RIGHTABS},
+	} {
+		o, bOk := srv.Widget(tc.sName)
+		if !bOk {
+			t.Fatalf("no %s", tc.sName)
+		}
+		if s := fmt.Sprintf("%d,%d,%d,%d", o.X, o.Y, o.W, o.H); s != tc.sRect {
+			t.Errorf("%s: %s, want %s", tc.sName, s, tc.sRect)
+		}
+		if iAnchor := fmt.Sprint(o.Props["Anchor"]); iAnchor != fmt.Sprint(tc.iAnchor) {
+			t.Errorf("%s: anchor %s, want %d", tc.sName, iAnchor, tc.iAnchor)
+		}
+	}
+
+	activate(t, srv, pWnd)
+	if err := srv.Fire("main", "onsize", "600", "400"); err != nil {
+		t.Fatal(err)
+	}
+	srv.Wait(func() bool { o, _ := srv.Widget("main.b"); return o.X != 312 }, time.Second)
+	if sLast := lastMsg(srv); !strings.HasPrefix(sLast, `["packet",`) || strings.Count(sLast, `"move"`) != 2 {
+		t.Errorf("moves aren't sent in one packet: %s", sLast)
+	}
+	for sName, sRect := range map[string]string{"main.e": "8,8,584,24", "main.b": "512,40,80,28"} {
+		if o, _ := srv.Widget(sName); fmt.Sprintf("%d,%d,%d,%d", o.X, o.Y, o.W, o.H) != sRect {
+			t.Errorf("%s after resizing: %d,%d,%d,%d, want %s", sName, o.X, o.Y, o.W, o.H, sRect)
+		}
+	}
+}
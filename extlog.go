@@ -0,0 +1,116 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// pLogger is a logger of the package, it is used, if Options.Logger isn't set.
+var pLogger atomic.Pointer[slog.Logger]
+
+func init() {
+	pLogger.Store(slog.New(discardHandler{}))
+}
+
+// SetLogger sets a logger of the package, which is used by sessions without Options.Logger
+// and by WriteLog. If l is nil, nothing is logged; it is so by default.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(discardHandler{})
+	}
+	pLogger.Store(l)
+}
+
+// Logger returns a logger of the package.
+func Logger() *slog.Logger {
+	return pLogger.Load()
+}
+
+// logger returns a logger of the session: Options.Logger or the logger of the package.
+func (s *Session) logger() *slog.Logger {
+	if s.opts.Logger != nil {
+		return s.opts.Logger
+	}
+	return Logger()
+}
+
+// logOr returns pLog or, if it is nil, the logger of the package.
+func logOr(pLog *slog.Logger) *slog.Logger {
+	if pLog != nil {
+		return pLog
+	}
+	return Logger()
+}
+
+// loggerSetter is implemented by transports, which write to a log: a session
+// passes its logger (Options.Logger) to them, when they are created.
+type loggerSetter interface {
+	setLogger(pLog *slog.Logger)
+}
+
+// WriteLog writes the sText to the logger of the package with the Info level.
+// It is kept for compatibility, set a logger with SetLogger to get the text.
+func WriteLog(sText string) {
+	Logger().Info(strings.TrimSpace(sText))
+}
+
+// msgAttrs returns log attributes of a message m: a command and a widget name, if any.
+func msgAttrs(m protocol.Msg) []interface{} {
+	attrs := []interface{}{"cmd", cmdOf(m)}
+	var sName string
+	switch v := m.(type) {
+	case protocol.Set:
+		sName = v.Name
+	case protocol.Get:
+		sName = v.Name
+	case protocol.AddWidg:
+		sName = v.Name
+	case protocol.CrDialog:
+		sName = v.Name
+	}
+	if sName != "" {
+		attrs = append(attrs, "widget", sName)
+	}
+	return attrs
+}
+
+func cmdOf(m protocol.Msg) string {
+	if a := m.Array(); len(a) > 0 {
+		if s, bOk := a[0].(string); bOk {
+			return s
+		}
+	}
+	return ""
+}
+
+// cmdName returns a command name of a marshalled message b.
+func cmdName(b []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return ""
+	}
+	if t, err := dec.Token(); err == nil {
+		if s, bOk := t.(string); bOk {
+			return s
+		}
+	}
+	return ""
+}
+
+// discardHandler is a slog.Handler, which drops all records.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,96 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"context"
+)
+
+// Run processes callbacks from the GuiServer and functions, passed to Post,
+// in the calling goroutine. It returns nil, when the application ends
+// (the GuiServer sends "endapp" or the connection is closed),
+// or ctx.Err(), if ctx is cancelled before.
+func (s *Session) Run(ctx context.Context) error {
+
+	s.muxQueue.Lock()
+	chDone := s.chDone
+	s.muxQueue.Unlock()
+
+	bWait := s.bWait.Swap(true)
+	defer s.bWait.Store(bWait)
+
+	for {
+		for fu := s.nextFunc(); fu != nil; fu = s.nextFunc() {
+			fu()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-chDone:
+			// Functions, posted before the end, are executed anyway.
+			for fu := s.nextFunc(); fu != nil; fu = s.nextFunc() {
+				fu()
+			}
+			return nil
+		case <-s.chWake:
+		}
+	}
+}
+
+// Wait processes callbacks from the GuiServer until the application ends.
+func (s *Session) Wait() {
+	s.Run(context.Background())
+}
+
+// Post adds the fu function to a queue of functions, which are executed by Run
+// (or Wait) in its goroutine. It may be called from any goroutine.
+func (s *Session) Post(fu func()) {
+	s.muxQueue.Lock()
+	s.aQueue = append(s.aQueue, fu)
+	s.muxQueue.Unlock()
+	select {
+	case s.chWake <- struct{}{}:
+	default:
+	}
+}
+
+// AddFuncToIdle adds a function to be executed while wait state.
+//
+// Deprecated: use Post.
+func (s *Session) AddFuncToIdle(fu func()) {
+	s.Post(fu)
+}
+
+func (s *Session) nextFunc() func() {
+	s.muxQueue.Lock()
+	defer s.muxQueue.Unlock()
+	if len(s.aQueue) == 0 {
+		return nil
+	}
+	fu := s.aQueue[0]
+	s.aQueue[0] = nil
+	s.aQueue = s.aQueue[1:]
+	return fu
+}
+
+// finish stops Run, it is called, when the application ends.
+func (s *Session) finish() {
+	s.muxQueue.Lock()
+	if !s.bEndProg {
+		s.bEndProg = true
+		close(s.chDone)
+	}
+	s.muxQueue.Unlock()
+}
+
+// restart prepares a finished session to be connected again.
+func (s *Session) restart() {
+	s.muxQueue.Lock()
+	if s.bEndProg {
+		s.bEndProg = false
+		s.chDone = make(chan struct{})
+	}
+	s.muxQueue.Unlock()
+}
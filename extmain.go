@@ -8,15 +8,18 @@
 package external
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
+	"log/slog"
 	"os"
-	"os/exec"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/alkresin/external/internal/protocol"
 )
 
 const (
@@ -25,256 +28,405 @@ const (
 	FileRoot = "gs"
 )
 
-type ConnEx struct {
-	iType int8
-	iPort int
-	sIp   string
-	sFileName string
-	conn  net.Conn
-	f    *os.File
+// Session is a connection to one GuiServer with all its windows, widgets,
+// fonts, styles, callback functions and menus.
+// Several sessions may be used in one program to work with several GuiServers.
+// The methods of a Session and of its widgets may be called from any goroutine:
+// messages to the GuiServer are sent one by one, each waits for its reply.
+// Menu definitions (Menu ... EndMenu) should be built in one goroutine.
+type Session struct {
+	opts Options
+
+	pConnOut, pConnIn Transport
+	bConnExist        atomic.Bool
+	bWait             atomic.Bool
+
+	// muxReconn lets only one reconnect restore the session at a time,
+	// bReconnecting is set, while it does it.
+	muxReconn     sync.Mutex
+	bReconnecting atomic.Bool
+
+	// muxOut serializes messages, sent via pConnOut, and their replies,
+	// because the protocol doesn't allow to match a reply to a message.
+	muxOut sync.Mutex
+
+	bPacket   bool
+	aPacket   protocol.Packet
+	muxPacket sync.Mutex
+
+	// mux guards the fields below and aWidgets of all widgets of the session.
+	mux sync.Mutex
+
+	// aQueue keeps functions, which must be executed by Run,
+	// chWake signals, that aQueue isn't empty, chDone is closed, when the application ends.
+	aQueue   []func()
+	chWake   chan struct{}
+	chDone   chan struct{}
+	bEndProg bool
+	muxQueue sync.Mutex
+
+	mfu         map[string]func([]string) string
+	mOnce       map[string]struct{}
+	pMainWindow *Widget
+	aDialogs    []*Widget
+	mWidg       map[string]*Widget // windows and widgets by full names, see register
+	aFonts      []*Font
+	aStyles     []*Style
+	iIdCount    int32
+
+	// aMenu is a stack of menus, which are defined now: a menu and its open submenus.
+	aMenu    []protocol.SubMenu
+	bMenuCtx bool
+
+	pProc  *srvProcess
+	caps   Capabilities
+	pTrace *tracer
+
+	// ctxSess is cancelled by Exit, it stops reconnecting.
+	ctxSess    context.Context
+	cancelSess context.CancelFunc
+
+	// rlog keeps messages, which are sent again after reconnecting (Options.Reconnect),
+	// pLastWnd is a window, which menus belong to.
+	rlog     replayLog
+	pLastWnd *Widget
+
+	// Last created widget and printer, see LastWidget and LastPrinter.
+	pLastWidget  *Widget
+	pLastPrinter *Printer
 }
 
-var sLogName = "egui.log"
-var bEndProg = false
-var bWait = false
-
-//var connOut, connIn net.Conn
-var bConnExist = false
-
-var pConnOut, pConnIn *ConnEx
-var sDir = ""
-var sFileRoot = FileRoot
+var pDefSess *Session
+var muxDefSess sync.Mutex
 
-var bPacket = false
-var sPacketBuf string
+func newSession() *Session {
+	return &Session{mfu: make(map[string]func([]string) string), mOnce: make(map[string]struct{}),
+		chWake: make(chan struct{}, 1), chDone: make(chan struct{})}
+}
 
-var aRunProc [][]string
-var muxRunProc sync.Mutex
+// DefaultSession returns the session, which is used by package-level functions
+// (Init, InitMainWindow, MsgInfo, etc.).
+func DefaultSession() *Session {
+	muxDefSess.Lock()
+	defer muxDefSess.Unlock()
+	if pDefSess == nil {
+		pDefSess = newSession()
+	}
+	return pDefSess
+}
 
-var aRunFu []func()
-var muxRunFu sync.Mutex
+// Dial runs, if needed, the Guiserver application, described in opts, connects to it
+// and returns a new Session. The aOpts functions, if any, modify opts before using.
+// The ctx argument governs the session lifetime: when it is cancelled,
+// the connection is closed and the GuiServer is stopped, as by Exit.
+func Dial(ctx context.Context, opts Options, aOpts ...Option) (*Session, error) {
+	s := newSession()
+	for _, fu := range aOpts {
+		fu(&opts)
+	}
+	if err := s.open(ctx, opts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
 
 // Init runs, if needed, the Guiserver application, and connects to it.
 // It returns 0, if the connection is successful, 1 - in other case,
-// 2 -if a protocol version of a GuiServer isn't equal to a local protocol.
-// The sOpt argument specifies connection details. It may contain following strings:
-// guiserver=<full path to GuiServer executable>
-// address=<ip address of a computer, where GuiServer runs>
-// port=<tcp/ip port number>
-// log=<0, 1 or 2> - logging level
-func Init(sOpt string) int {
+// 2 -if a protocol version of a GuiServer isn't one of Options.AcceptProtocols.
+// The sOpt argument specifies connection details in a format, described in ParseOptions,
+// wrong lines are written to the log and skipped.
+// The aOpts functions, if any, modify options after sOpt is parsed.
+func Init(sOpt string, aOpts ...Option) int {
+
+	opts, err := ParseOptions(strings.NewReader(sOpt))
+	for _, fu := range aOpts {
+		fu(&opts)
+	}
+	if err != nil {
+		pLog := opts.Logger
+		if pLog == nil {
+			pLog = Logger()
+		}
+		pLog.Warn("wrong options", "err", err)
+	}
+	err = DefaultSession().open(context.Background(), opts)
+	var errVer *ErrProtocolMismatch
+	if errors.As(err, &errVer) {
+		return 2
+	} else if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func (s *Session) open(ctx context.Context, opts Options) error {
 
 	var err error
 
-	iConnType := 1
-	iPort := 3101
-	sServer := "guiserver"
-	sIp := "127.0.0.1"
-	sFileName := ""
-	sLog := ""
-	if sOpt != "" {
-		var arr []string
-		sep := "\r\n"
-		if !strings.Contains(sOpt, sep) {
-			if sep = "\n"; !strings.Contains(sOpt, sep) {
-				sep = ""
-			}
-		}
-		if sep == "" {
-			arr = make([]string, 1, 1)
-			arr[0] = sOpt
-		} else {
-			arr = strings.Split(sOpt, sep)
+	opts.setDefaults()
+	s.opts = opts
+	s.restart()
+	s.mux.Lock()
+	s.pProc = nil
+	s.mux.Unlock()
+	sFileName := opts.fileName()
+
+	if err = checkDeclared(opts); err != nil {
+		return err
+	}
+	if opts.Type == TypeFile && opts.Server != "" {
+		os.Remove(sFileName)
+	}
+
+	if opts.Trace != "" {
+		if s.pTrace, err = newTracer(opts.Trace, s.logger()); err != nil {
+			return err
 		}
-		for i := 0; i < len(arr); i++ {
-			s := strings.ToLower(arr[i])
-			if len(s) > 9 && s[:9] == "guiserver" {
-				sServer = strings.TrimSpace(s[10:])
-			} else if len(s) > 8 && s[:7] == "address" {
-				sIp = strings.TrimSpace(s[8:])
-			} else if len(s) > 5 && s[:4] == "port" {
-				iPort, _ = strconv.Atoi(strings.TrimSpace(s[5:]))
-			} else if len(s) > 5 && s[:4] == "type" {
-				iConnType, _ = strconv.Atoi(strings.TrimSpace(s[5:]))
-			} else if len(s) > 5 && s[:3] == "dir" {
-				sDir = strings.TrimSpace(s[4:])
-			} else if len(s) > 5 && s[:4] == "file" {
-				sFileRoot = strings.TrimSpace(s[5:])
-				if strings.Contains(sFileRoot, "*") {
-					sz := strconv.Itoa(int((time.Now().UnixNano() / 1000000) % 100000))
-					sFileRoot = strings.Replace(sFileRoot, "*", sz, -1)
-				}
-			} else if len(s) > 2 && s[:3] == "log" {
-				if s[4:5] == "1" {
-					sLog = "-log1"
-				} else if s[4:5] == "2" {
-					sLog = "-log2"
-				}
-			}
+	}
+	if opts.Server != "" {
+		if err = s.startServer(opts); err != nil {
+			s.closeTrace()
+			return err
 		}
 	}
+	s.muxOut.Lock()
+	err = s.connect(ctx, opts, sFileName)
+	s.muxOut.Unlock()
+	if err != nil {
+		s.stopServer(0)
+		s.closeTrace()
+		return err
+	}
+	s.ctxSess, s.cancelSess = context.WithCancel(ctx)
+	s.muxQueue.Lock()
+	chDone := s.chDone
+	s.muxQueue.Unlock()
+	go s.watch(ctx, chDone)
+	return nil
+}
 
-	buf := make([]byte, 128)
+// connect establishes both connections to the GuiServer, checks its protocol version
+// and gets its capabilities. muxOut must be locked.
+func (s *Session) connect(ctx context.Context, opts Options, sFileName string) error {
 
-	if iConnType == 2 {
-		if sDir == "" {
-			sDir = os.TempDir()
-		}
-		sFileName = sDir + string(os.PathSeparator) + sFileRoot
-		if sServer != "" {
-			os.Remove(sFileName)
-		}
+	var err error
+
+	if err = sleepCtx(ctx, 100*time.Millisecond); err != nil {
+		return err
 	}
 
-	if sServer != "" {
-		var cmd *exec.Cmd
-		if iConnType == 2 && (sDir != "" || sFileRoot != FileRoot) {
-			cmd = exec.Command(sServer, fmt.Sprintf("-p%d", iPort), "-t2", sLog, "-d"+sDir, "-f"+sFileRoot )
-		} else {
-			cmd = exec.Command(sServer, fmt.Sprintf("-p%d", iPort), fmt.Sprintf("-t%d", iConnType), sLog)
-		}
-		cmd.Start()
+	if s.pConnOut, s.pConnIn, err = s.newTransports(opts, sFileName); err != nil {
+		return err
+	}
+	if s.pTrace != nil {
+		s.pConnOut, s.pConnIn = s.pTrace.wrap(s.pConnOut, 0), s.pTrace.wrap(s.pConnIn, 1)
 	}
-	time.Sleep(100 * time.Millisecond)
 
-	pConnOut = &ConnEx{ iType: int8(iConnType), iPort: iPort, sIp: sIp, sFileName: sFileName+".gs1" }
-	pConnIn = &ConnEx{ iType: int8(iConnType), iPort: iPort+1, sIp: sIp, sFileName: sFileName+".gs2" }
+	ctxConn, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+	defer cancel()
 
-	if !pConnOut.Connect() {
-		return 1
+	if err = s.pConnOut.Dial(ctxConn); err != nil {
+		return connError(err)
 	}
 
-	bConnExist = true
-	
-	iBufLen, err := pConnOut.Read(&buf)
+	b, err := s.pConnOut.ReadMsg()
 
 	if err != nil {
-		WriteLog(fmt.Sprintln(err))
-		pConnOut.Close()
-		bConnExist = false
-		return 1
+		s.logger().Error("no handshake", "channel", 0, "err", err)
+		return s.connFailed(connError(err))
 	}
-	sVer := string(buf[:iBufLen-1])
+	sVer := string(b)
 	sVer = sVer[(strings.Index(sVer, "/") + 1):]
 
-	if !pConnIn.Connect() {
-		return 1
+	if err = s.pConnIn.Dial(ctxConn); err != nil {
+		return s.connFailed(connError(err))
 	}
 
-	_, err = pConnIn.Read(&buf)
+	_, err = s.pConnIn.ReadMsg()
 
 	if err != nil {
-		WriteLog(fmt.Sprintln(err))
-		Exit()
-		return 1
+		s.logger().Error("no handshake", "channel", 1, "err", err)
+		return s.connFailed(connError(err))
 	}
 
-	if sVer != VerProto {
-		WriteLog("\r\nProtocol version mismatched. Need " + VerProto + ", received " + sVer)
-		Exit()
-		return 2
+	bOk := false
+	for _, v := range opts.AcceptProtocols {
+		if v == sVer {
+			bOk = true
+		}
+	}
+	if !bOk {
+		sWant := strings.Join(opts.AcceptProtocols, ", ")
+		s.logger().Error("protocol version mismatched", "want", sWant, "got", sVer)
+		return s.connFailed(&ErrProtocolMismatch{Want: sWant, Got: sVer})
 	}
 
-	if iConnType == 2 {
-		pConnIn.Write( "+[\"Ok\"]\n" )
+	if opts.Type == TypeFile && opts.Transport == nil {
+		s.pConnIn.WriteMsg(protocol.ReplyOk)
 	}
 
-	WriteLog( "Init-1\r\n" )
-	go listen(iPort + 1)
+	caps, err := s.queryCaps(sVer)
+	if err != nil {
+		return s.connFailed(err)
+	}
+	s.mux.Lock()
+	s.caps = caps
+	s.mux.Unlock()
+	if sFeature, bOk := mDeclared[opts.Type]; bOk && opts.Transport == nil && !s.Supports(sFeature) {
+		return s.connFailed(s.unsupported(sFeature))
+	}
+	s.logger().Info("connected", "guiserver", caps.GuiServer, "proto", caps.Proto)
+
+	// The connection is ready only now, Exit and reconnect don't touch it before.
+	s.bConnExist.Store(true)
+	go s.listen(s.pConnIn)
 	time.Sleep(100 * time.Millisecond)
 
-	return 0
+	return nil
 }
 
-// Exit closes the connection to Guiserver.
-func Exit() {
-	if bConnExist {
-		bConnExist = false
-		pConnOut.Write("+[\"exit\"]\n")
+// connFailed closes connections, opened by connect, and returns err. The session
+// isn't finished: open or reconnect decide, what to do further.
+func (s *Session) connFailed(err error) error {
+	s.bConnExist.Store(false)
+	s.pConnOut.Close()
+	s.pConnIn.Close()
+	return err
+}
+
+// breakConn closes connections, which can't be used more, after a send error or a reply timeout.
+// listen gets an error then and reconnects (see Options.Reconnect) or finishes the session.
+func (s *Session) breakConn() {
+	s.pConnOut.Close()
+	s.pConnIn.Close()
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Exit closes the connection to Guiserver. If the GuiServer was started by the session,
+// Exit waits for it to finish during the Options.ShutdownGrace period and then terminates it;
+// if the connection is lost already, the GuiServer is terminated at once.
+func (s *Session) Exit() {
+	if s.cancelSess != nil {
+		s.cancelSess()
+	}
+	var dGrace time.Duration
+	if s.bConnExist.CompareAndSwap(true, false) {
+		// If other goroutine waits for a reply now, we don't wait for it,
+		// closing the connection will stop it.
+		if s.muxOut.TryLock() {
+			if b, err := protocol.Marshal(protocol.NewCmd("exit")); err == nil {
+				s.pConnOut.WriteMsg(b)
+			}
+			s.muxOut.Unlock()
+		}
 		time.Sleep(10 * time.Millisecond)
-		pConnOut.Close()
-		pConnIn.Close()
+		s.pConnOut.Close()
+		s.pConnIn.Close()
+		dGrace = s.opts.ShutdownGrace
 	}
+	s.stopServer(dGrace)
+	s.closeTrace()
 }
 
-func listen(iPort int) {
+// closeTrace closes a trace file, if Options.Trace is set.
+func (s *Session) closeTrace() {
+	if s.pTrace != nil {
+		s.pTrace.Close()
+	}
+}
+
+// listen reads events of the GuiServer from a connection pIn and answers them.
+func (s *Session) listen(pIn Transport) {
 
 	var bErr bool
 
-	buffer := make([]byte, 1024)
-	arr := make([]string, 5)
 	for {
 
 		bErr = false
-		length, err := pConnIn.Read(&buffer)
+		buffer, err := pIn.ReadMsg()
 
+		if errors.Is(err, ErrMessageTooLarge) {
+			s.logger().Warn("event is skipped", "err", err)
+			pIn.WriteMsg(protocol.ReplyError)
+			continue
+		}
 		if err != nil {
 			//WriteLog("Read error\r\n")
+			if s.opts.Reconnect && (s.bConnExist.Load() || s.bReconnecting.Load()) {
+				go s.reconnect(pIn)
+				return
+			}
+			// The GuiServer can't get "exit" now, Exit terminates it at once.
+			s.bConnExist.Store(false)
+			s.finish()
 			return
 		}
 
-		if buffer[0] != byte('+') || buffer[length-1] != byte('\n') {
+		arr, err := protocol.DecodeEvent(buffer)
+		if err != nil || len(arr) == 0 {
+			// The GuiServer waits for an answer to any event.
+			pIn.WriteMsg(protocol.ReplyError)
 			bErr = true
 		}
 
-		if !bErr {
-			err = json.Unmarshal(buffer[1:length-1], &arr)
-			if err != nil {
-				WriteLog("Unmarshal error\r\n")
-				bErr = true
-			}
-		}
-
 		//fmt.Printf("Received command %d\t:%s %d\n", length, string(buffer[:length]), len(arr))
 
-		if !bErr && len(arr) > 0 {
+		if !bErr {
 			switch arr[0] {
 			case "runproc":
 				//sendResponse(connIn, "[\"Ok\"]")
-				pConnIn.Write( "+[\"Ok\"]\n" )
+				pIn.WriteMsg(protocol.ReplyOk)
 				if len(arr) > 1 {
-					if bWait {
+					if s.bWait.Load() {
 						tmp := make([]string, len(arr))
-						muxRunProc.Lock()
 						copy(tmp, arr)
-						aRunProc = append(aRunProc, tmp)
-						muxRunProc.Unlock()
+						s.Post(func() { s.runproc(tmp) })
 					} else {
-						runproc(arr)
+						s.runproc(arr)
 					}
 				} else {
 					bErr = true
 				}
 			case "runfunc":
 				if len(arr) > 1 {
-					if fnc, bExist := mfu[arr[1]]; bExist {
+					if fnc := s.getFunc(arr[1]); fnc != nil {
 						var ap []string
 						if len(arr) > 2 {
 							ap = make([]string, 5)
 							err = json.Unmarshal([]byte(arr[2]), &ap)
 							if err != nil {
-								WriteLog(fmt.Sprintf("runproc param Unmarshal error (%s)\r\n", arr[2]))
+								s.logger().Warn("wrong parameters", "func", arr[1], "params", arr[2])
 							}
 						}
 						//WriteLog(fmt.Sprintf("pgo> (%s) len:%d\r\n",arr[2],len(ap) ))
-						s := fnc(ap)
-						b, _ := json.Marshal(s)
+						sRes := fnc(ap)
+						b, _ := json.Marshal(sRes)
 						//sendResponse(connIn, string(b))
-						pConnIn.Write("+" + string(b) + "\n")
+						pIn.WriteMsg(b)
 					} else {
 						//sendResponse(connIn, "[\"Err\"]")
-						pConnIn.Write("+[\"Err\"]" + "\n")
+						pIn.WriteMsg(protocol.ReplyErr)
 					}
 				} else {
 					bErr = true
 					//sendResponse(connIn, "[\"Err\"]")
-					pConnIn.Write("+[\"Err\"]\n")
+					pIn.WriteMsg(protocol.ReplyErr)
 				}
 			case "exit":
 				//sendResponse(connIn, "[\"Ok\"]")
-				pConnIn.Write("+[\"Ok\"]\n")
+				pIn.WriteMsg(protocol.ReplyOk)
 				if len(arr) > 1 {
-					oW := Wnd(arr[1])
+					oW := s.Wnd(arr[1])
 					if oW != nil {
 						oW.delete()
 					}
@@ -283,318 +435,184 @@ func listen(iPort int) {
 				}
 			case "endapp":
 				//sendResponse(connIn, "[\"Goodbye\"]")
-				pConnIn.Write("+[\"Goodbye\"]\n")
+				pIn.WriteMsg(protocol.ReplyGoodbye)
 				time.Sleep(100 * time.Millisecond)
-				bEndProg = true
-				//connIn.Close()
-				//pConnIn.Close()
-				Exit()
+				s.Exit()
+				s.finish()
 				//WriteLog("The End")
 				return
 			default:
 				//sendResponse(connIn, "[\"Error\"]")
-				pConnIn.Write("+[\"Error\"]\n")
+				pIn.WriteMsg(protocol.ReplyError)
 				bErr = true
 			}
 		}
 		if bErr {
-			WriteLog(fmt.Sprintf("Wrong message: %s]\r\n", string(buffer[:length])))
+			s.logger().Warn("wrong event", "event", string(buffer))
 		}
 	}
 }
 
-/*
-func read(conn net.Conn, pBuff *[]byte) (int, error) {
-	*pBuff = (*pBuff)[:0]
-	tmp := make([]byte, 256)
-	for {
-		length, err := conn.Read(tmp)
-		if err != nil {
-			WriteLog("Read error\r\n")
-			return 0, err
+func (s *Session) sendout(m protocol.Msg) error {
+
+	s.muxPacket.Lock()
+	if s.bPacket {
+		if err := s.checkCmd(m); err != nil {
+			s.muxPacket.Unlock()
+			return err
 		}
-		*pBuff = append(*pBuff, tmp[:length]...)
-		if tmp[length-1] == '\n' {
-			break
+		b, err := protocol.Marshal(m)
+		if err == nil {
+			s.aPacket = append(s.aPacket, b)
 		}
+		s.muxPacket.Unlock()
+		return err
 	}
-	return len(*pBuff), nil
-}
-
-func sendResponse(conn net.Conn, s string) {
-	conn.Write([]byte("+" + s + "\n"))
+	s.muxPacket.Unlock()
+	b, err := s.sendoutAndReturn(m)
+	if err != nil {
+		return err
+	}
+	if err = checkReply(b); err != nil {
+		s.logger().Warn("message is rejected", append(msgAttrs(m), "reply", string(b))...)
+	}
+	return err
 }
-*/
 
-func sendout(s string) bool {
+func (s *Session) sendoutAndReturn(m protocol.Msg) ([]byte, error) {
 
-	var err error
-
-	if bPacket {
-		sPacketBuf += "," + s
-	} else {
-		if !bConnExist {
-			WriteLog("sendout: No connection established.\r\n")
-			return false
-		}
-
-		//_, err = connOut.Write([]byte("+" + s + "\n"))
-		_, err = pConnOut.Write("+" + s + "\n")
-		if err != nil {
-			fmt.Println(err)
-			return false
-		}
-
-		buf := make([]byte, 128)
-		//_, err = connOut.Read(buf)
-		_, err = pConnOut.Read(&buf)
-		if err != nil {
-			fmt.Println(err)
-			return false
-		}
+	if !s.bConnExist.Load() {
+		s.logger().Warn("no connection", msgAttrs(m)...)
+		return nil, ErrNotConnected
+	}
+	if err := s.checkCmd(m); err != nil {
+		return nil, err
+	}
+	bMsg, err := protocol.Marshal(m)
+	if err != nil {
+		s.logger().Error("can't marshal a message", append(msgAttrs(m), "err", err)...)
+		return nil, err
+	}
+	if pLog := s.logger(); pLog.Enabled(context.Background(), slog.LevelDebug) {
+		pLog.Debug("send", msgAttrs(m)...)
 	}
-	return true
-}
 
-func sendoutAndReturn(s string) []byte {
+	s.muxOut.Lock()
+	defer s.muxOut.Unlock()
 
-	var err error
-	buf := make([]byte, 1024)
+	return s.exchange(bMsg)
+}
 
-	if !bConnExist {
-		WriteLog("sendoutAndReturn: No connection established.\r\n")
-		return []byte("")
-	}
+// exchange sends a message to GuiServer and returns its reply, muxOut must be locked.
+func (s *Session) exchange(bMsg []byte) ([]byte, error) {
 
-	//_, err = connOut.Write([]byte("+" + s + "\n"))
-	_, err = pConnOut.Write("+" + s + "\n")
+	err := s.pConnOut.WriteMsg(bMsg)
 	if err != nil {
-		fmt.Println(err)
-		return []byte("")
+		s.logger().Error("can't send a message", "cmd", cmdName(bMsg), "err", err)
+		s.breakConn()
+		return nil, connError(err)
 	}
-	//length, err = connOut.Read(buf)
-	//length, err := read(connOut, &buf)
-	length, err := pConnOut.Read(&buf)
+	b, err := s.pConnOut.ReadMsg()
 	if err != nil {
-		fmt.Println(err)
-		return []byte("")
+		s.logger().Error("no reply", "cmd", cmdName(bMsg), "err", err)
+		if !errors.Is(err, ErrMessageTooLarge) {
+			// A late reply would be read as a reply to the next message.
+			s.breakConn()
+		}
+		return nil, connError(err)
 	}
-	return buf[:length-1]
+	return b, nil
 }
 
 // BeginPacket begins a sequence of functions, which creates or modifies GUI elements,
 // for to join messages to Guiserver to one packet.
-func BeginPacket() {
-	bPacket = true
-	sPacketBuf = "[\"packet\""
+func (s *Session) BeginPacket() {
+	s.muxPacket.Lock()
+	s.bPacket = true
+	s.aPacket = nil
+	s.muxPacket.Unlock()
 }
 
 // EndPacket completes a sequence of functions, started by BeginPacket
-func EndPacket() {
-	bPacket = false
-	sendout(sPacketBuf + "]")
-	sPacketBuf = ""
+func (s *Session) EndPacket() error {
+	s.muxPacket.Lock()
+	aPacket := s.aPacket
+	s.bPacket = false
+	s.aPacket = nil
+	s.muxPacket.Unlock()
+	return s.sendout(aPacket)
 }
 
-// WriteLog writes the sText to a log file egui.log.
-func WriteLog(sText string) {
+// sendPacket sends messages aMsg in one packet; unlike BeginPacket and EndPacket it doesn't
+// touch a packet of the session, so messages of other goroutines don't get into it.
+func (s *Session) sendPacket(aMsg []protocol.Msg) error {
 
-	f, err := os.OpenFile(sLogName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return
+	aPacket := make(protocol.Packet, 0, len(aMsg))
+	for _, m := range aMsg {
+		if err := s.checkCmd(m); err != nil {
+			return err
+		}
+		b, err := protocol.Marshal(m)
+		if err != nil {
+			return err
+		}
+		aPacket = append(aPacket, b)
 	}
-	defer f.Close()
-
-	f.WriteString(sText)
-
+	return s.sendout(aPacket)
 }
 
 // RegFunc adds the fu func to a map of functions,
 // sName argument is a function identifier - a key of this map.
 // You may need to call this function in case of using HWGui's xml forms.
-func RegFunc(sName string, fu func([]string) string) {
+// A function, registered with the same name before, is replaced and a warning is written
+// to the log; names, generated for handlers (see SetCallBackProc), can't be used.
+func (s *Session) RegFunc(sName string, fu func([]string) string) {
+	s.mux.Lock()
+	_, bExist := s.mfu[sName]
+	bGen := isGenerated(sName)
+	if !bGen {
+		s.mfu[sName] = fu
+		delete(s.mOnce, sName)
+	}
+	s.mux.Unlock()
+	if bGen {
+		s.logger().Error("a function isn't registered, the name is reserved for handlers", "name", sName)
+	} else if bExist {
+		s.logger().Warn("a function is replaced", "name", sName)
+	}
+}
 
-	if mfu == nil {
-		mfu = make(map[string]func([]string) string)
+func (s *Session) getFunc(sName string) func([]string) string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	fu := s.mfu[sName]
+	if _, bOk := s.mOnce[sName]; bOk {
+		delete(s.mfu, sName)
+		delete(s.mOnce, sName)
 	}
-	mfu[sName] = fu
+	return fu
 }
 
-// AddFuncToIdle adds a function to be executed while wait state.
-func AddFuncToIdle(fu func()) {
-	muxRunFu.Lock()
-	aRunFu = append(aRunFu, fu)
-	muxRunFu.Unlock()
+// newName returns a unique name for a widget, font, etc., started with sPrefix.
+func (s *Session) newName(sPrefix string) string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	sName := fmt.Sprintf("%s%d", sPrefix, s.iIdCount)
+	s.iIdCount++
+	return sName
 }
 
-func runproc(arr []string) {
-	if fnc, bExist := mfu[arr[1]]; bExist {
+func (s *Session) runproc(arr []string) {
+	if fnc := s.getFunc(arr[1]); fnc != nil {
 		var ap []string
 		if len(arr) > 2 {
 			ap = make([]string, 5)
 			err := json.Unmarshal([]byte(arr[2]), &ap)
 			if err != nil {
-				WriteLog(fmt.Sprintf("runproc param Unmarshal error (%s)\r\n", arr[2]))
+				s.logger().Warn("wrong parameters", "func", arr[1], "params", arr[2])
 			}
 		}
 		//WriteLog(fmt.Sprintf("pgo> (%s) len:%d\r\n",arr[2],len(ap) ))
 		fnc(ap)
 	}
 }
-
-func Wait() {
-	bWait = true
-	for !bEndProg {
-		for {
-			muxRunFu.Lock()
-			if len(aRunFu) == 0 {
-				muxRunFu.Unlock()
-				break
-			}
-			fu := aRunFu[0]
-			aRunFu = append(aRunFu[:0], aRunFu[1:]...)
-			muxRunFu.Unlock()
-
-			fu()
-		}
-		for {
-			muxRunProc.Lock()
-			if len(aRunProc) == 0 {
-				muxRunProc.Unlock()
-				break
-			}
-			arr := aRunProc[0]
-			aRunProc = append(aRunProc[:0], aRunProc[1:]...)
-			muxRunProc.Unlock()
-
-			runproc(arr)
-		}
-		time.Sleep(20 * time.Millisecond)
-	}
-	bWait = false
-}
-
-func (p *ConnEx) Connect() bool {
-
-	var err error
-
-	if p.iType == 1 {
-		p.conn, err = net.Dial("tcp4", fmt.Sprintf("%s:%d", p.sIp, p.iPort))
-		if err != nil {
-			time.Sleep(1000 * time.Millisecond)
-			p.conn, err = net.Dial("tcp4", fmt.Sprintf("%s:%d", p.sIp, p.iPort))
-			if err != nil {
-				time.Sleep(3000 * time.Millisecond)
-				p.conn, err = net.Dial("tcp4", fmt.Sprintf("%s:%d", p.sIp, p.iPort))
-				if err != nil {
-					WriteLog(fmt.Sprintln(p.sIp, p.iPort))
-					WriteLog(fmt.Sprintln(err))
-					return false
-				}
-			}
-		}
-	} else if p.iType == 2 {
-		//os.Remove(p.sFileName)
-		p.f,err = os.OpenFile(p.sFileName, os.O_RDWR, 0644)
-		if err != nil {
-			time.Sleep(1000 * time.Millisecond)
-			p.f,err = os.OpenFile(p.sFileName, os.O_RDWR, 0644)
-			if err != nil {
-				time.Sleep(3000 * time.Millisecond)
-				p.f,err = os.OpenFile(p.sFileName, os.O_RDWR, 0644)
-				if err != nil {
-					WriteLog(p.sFileName)
-					WriteLog(fmt.Sprintln(err))
-					return false
-				}
-			}
-		}
-	}
-
-	return true
-}
-
-func (p *ConnEx) Close() {
-
-	if p.iType == 1 {
-		p.conn.Close()
-	} else if p.iType == 2 {
-		p.f.Close()
-	}
-}
-
-func (p *ConnEx) Read(pBuff *[]byte) (int, error) {
-
-	*pBuff = (*pBuff)[:0]
-	tmp := make([]byte, 256)
-	if p.iType == 1 {
-		for {
-			length, err := p.conn.Read(tmp)
-			if err != nil {
-				WriteLog("Read error\r\n")
-				return 0, err
-			}
-			*pBuff = append(*pBuff, tmp[:length]...)
-			if tmp[length-1] == '\n' {
-				break
-			}
-		}
-		return len(*pBuff), nil
-	} else if p.iType == 2 {
-		b1 := make([]byte, 1)
-		for bConnExist {
-			p.f.Seek(0,0)
-			_, err := p.f.Read(b1)
-			if err != nil {
-				WriteLog("Read error\r\n")
-				return 0, err
-			}
-			if b1[0] == 2 {
-				for ;; {
-					n, err := p.f.Read(tmp)
-					if err != nil {
-						WriteLog("Read error\r\n")
-						return 0, err
-					}
-					iPos := -1
-					for i := 0; i < n; i++ {
-						if tmp[i] == 10 {
-							iPos = i
-							break
-						}
-					}
-					if iPos >= 0 {
-						*pBuff = append(*pBuff, tmp[:iPos+1]...)
-						break
-					} else if n < len(tmp) {
-						*pBuff = append(*pBuff, tmp[:n+1]...)
-						break
-					} else {
-						*pBuff = append(*pBuff, tmp...)
-					}
-				}
-				break
-			} else {
-				time.Sleep(2 * time.Millisecond)
-			}
-		}
-		//WriteLog(string(*pBuff))
-		return len(*pBuff), nil
-	}
-
-   return 0, nil
-}
-
-func (p *ConnEx) Write( s string ) (int, error) {
-
-	var err error
-
-	if p.iType == 1 {
-		_, err = p.conn.Write( []byte(s) )
-	} else if p.iType == 2 {
-		p.f.WriteAt( []byte(s), 1 )
-		p.f.WriteAt( []byte{1}, 0 )
-	}
-
-	return 0, err
-}
\ No newline at end of file
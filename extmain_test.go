@@ -0,0 +1,161 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+// dial connects a new session to a fake GuiServer srv, they are closed, when a test ends.
+func dial(t *testing.T, srv *externaltest.Server, aOpts ...egui.Option) *egui.Session {
+	t.Helper()
+	aOpts = append([]egui.Option{egui.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, aOpts...)
+	s, err := egui.Dial(context.Background(), srv.Pipe(), aOpts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Exit()
+		srv.Close()
+	})
+	return s
+}
+
+// mainWindow creates a main window of a session s.
+func mainWindow(t *testing.T, s *egui.Session) *egui.Widget {
+	t.Helper()
+	pWnd := &egui.Widget{Title: "Main", W: 400, H: 300}
+	if err := s.InitMainWindow(pWnd); err != nil {
+		t.Fatal(err)
+	}
+	return pWnd
+}
+
+// activate activates a main window pWnd, so that the fake GuiServer srv may send events.
+func activate(t *testing.T, srv *externaltest.Server, pWnd *egui.Widget) {
+	t.Helper()
+	go pWnd.Activate()
+	if !srv.Wait(func() bool { o, _ := srv.Widget("main"); return o.Active }, time.Second) {
+		t.Fatal("the window isn't activated")
+	}
+}
+
+// reHandler finds a name of a function of the program in a callback code.
+var reHandler = regexp.MustCompile(`[fp]go\("([^"]+)"`)
+
+// lastMsg returns a last message, which a fake GuiServer srv has got.
+func lastMsg(srv *externaltest.Server) string {
+	aMsg := srv.Messages()
+	if len(aMsg) == 0 {
+		return ""
+	}
+	return aMsg[len(aMsg)-1]
+}
+
+func TestReplyOrder(t *testing.T) {
+	srv := externaltest.NewServer()
+	srv.Eval = func(sCode string) string {
+		return "reply to " + sCode
+	}
+	s := dial(t, srv)
+
+	var wg sync.WaitGroup
+	aErrs := make([]error, 50)
+	for i := range aErrs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sCode := fmt.Sprintf("code%d", i)
+			b, err := s.EvalFunc(sCode)
+			if err == nil && string(b) != "reply to "+sCode {
+				err = fmt.Errorf("%s got %q", sCode, b)
+			}
+			aErrs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range aErrs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReplyTimeout(t *testing.T) {
+	srv := externaltest.NewServer()
+	srv.ReplyTimeout = 50 * time.Millisecond
+	srv.Eval = func(sCode string) string {
+		if sCode == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return sCode
+	}
+	s := dial(t, srv)
+
+	if b, err := s.EvalFunc("fast"); err != nil || string(b) != "fast" {
+		t.Fatalf("fast: %q, %v", b, err)
+	}
+	if b, err := s.EvalFunc("slow"); !errors.Is(err, egui.ErrTimeout) {
+		t.Fatalf("slow: %q, %v, want ErrTimeout", b, err)
+	}
+	// The connection is closed, a late reply mustn't be taken as a reply to a next message.
+	time.Sleep(250 * time.Millisecond)
+	if b, err := s.EvalFunc("next"); err == nil {
+		t.Fatalf("next: %q after a timeout", b)
+	}
+}
+
+func TestWrongEvents(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	s.RegFunc("fnc", func([]string) string { return "done" })
+
+	for _, sEvent := range []string{`not json`, `[]`, `["nosuchevent"]`} {
+		sAnswer, err := srv.SendEvent(sEvent)
+		if err != nil || sAnswer == "" || sAnswer == `["Ok"]` {
+			t.Errorf("%s: answer %q, %v", sEvent, sAnswer, err)
+		}
+	}
+	// The session keeps working.
+	if sRes, err := srv.RunFunc("fnc"); err != nil || sRes != "done" {
+		t.Errorf("after wrong events: %q, %v", sRes, err)
+	}
+}
+
+func TestExitStopsServer(t *testing.T) {
+	sPath, _ := stubServer(t, 0)
+	srv := externaltest.NewServer()
+	s := dial(t, srv, func(o *egui.Options) { o.Server = sPath })
+
+	// The connection is lost, the GuiServer process keeps running.
+	srv.Close()
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-s.Done():
+		t.Fatal("the process is stopped without Exit")
+	default:
+	}
+	tStart := time.Now()
+	s.Exit()
+	select {
+	case <-s.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("the process isn't stopped")
+	}
+	if d := time.Since(tStart); d > time.Second {
+		t.Errorf("the process is stopped in %v, it can't get exit", d)
+	}
+}
@@ -5,113 +5,116 @@
 package external
 
 import (
-	"strconv"
-	"encoding/json"
-)
+	"fmt"
 
-var sMenu = ""
-var iStackLen = 0
+	"github.com/alkresin/external/internal/protocol"
+)
 
 // Menu starts a window's menu or submenu definition, sTitle is a menu title.
-func Menu(sTitle string) {
+func (s *Session) Menu(sTitle string) {
 
-	if sMenu == "" {
-		sMenu = "[\"menu\",["
+	if len(s.aMenu) == 0 {
+		s.aMenu = append(s.aMenu, protocol.SubMenu{})
+		s.bMenuCtx = false
 	} else {
-		if sMenu[len(sMenu)-1] != '[' {
-			sMenu += ","
-		}
-		sMenu += "[\"" + sTitle + "\",["
-		iStackLen++
+		s.aMenu = append(s.aMenu, protocol.SubMenu{Title: sTitle})
 	}
 }
 
 // MenuContext starts a context menu, sName is a menu identifier
-func MenuContext(sName string) {
+func (s *Session) MenuContext(sName string) {
 
-	if sMenu == "" {
-		sMenu = "[\"menucontext\",\"create\",\"" + sName + "\",["
+	if len(s.aMenu) == 0 {
+		s.aMenu = append(s.aMenu, protocol.SubMenu{Title: sName})
+		s.bMenuCtx = true
 	}
 }
 
 // Show context menu on the screen
-func ShowMenuContext(sName string, pWnd *Widget) {
+func (s *Session) ShowMenuContext(sName string, pWnd *Widget) error {
 	var sWndName string
 	if pWnd == nil {
 		sWndName = ""
 	} else {
 		sWndName = pWnd.Name
 	}
-	sendout("[\"menucontext\",\"show\",\"" + sName + "\",\"" + sWndName + "\"]")
+	return s.sendout(protocol.NewCmd("menucontext", "show", sName, sWndName))
 }
 
 // EndMenu completes a window's menu or submenu definition
-func EndMenu() {
-	sMenu += "]]"
-	if iStackLen == 0 {
-		sendout(sMenu)
-		sMenu = ""
+func (s *Session) EndMenu() error {
+
+	if len(s.aMenu) == 0 {
+		return nil
+	}
+	pMenu := s.aMenu[len(s.aMenu)-1]
+	s.aMenu = s.aMenu[:len(s.aMenu)-1]
+	if len(s.aMenu) > 0 {
+		s.addMenuEntry(pMenu)
+		return nil
+	}
+	var sParams protocol.Msg
+	if s.bMenuCtx {
+		sParams = protocol.MenuContext{Name: pMenu.Title, Items: pMenu.Items}
 	} else {
-		iStackLen--
+		sParams = protocol.Menu{Items: pMenu.Items}
 	}
+	s.record(s.lastWnd(), "", sParams)
+	return s.sendout(sParams)
 }
 
-func getscode(fu func([]string) string, sCode string, params ...string) string {
+// addMenuEntry adds an item, a separator or a submenu to the menu, which is defined now.
+func (s *Session) addMenuEntry(x interface{}) {
+	if len(s.aMenu) == 0 {
+		return
+	}
+	pMenu := &s.aMenu[len(s.aMenu)-1]
+	pMenu.Items = append(pMenu.Items, x)
+}
+
+func (s *Session) getscode(fu func([]string) string, sCode string, params ...string) string {
 	if fu != nil {
-		RegFunc(sCode, fu)
-		sCode = "pgo(\"" + sCode + "\",{\"menu\""
-		for _, v := range params {
-			sCode += ",\"" + v + "\""
-		}
-		sCode += "})"
+		sCode = s.callback(s.lastWnd(), "", false, fu, sCode)
+		sCode = protocol.Pgo(sCode, append([]string{"menu"}, params...)...)
 	}
-	b, _ := json.Marshal(sCode)
-	return string(b)
+	return sCode
 }
 
 // AddMenuItem adds a new item to the Window's menu or submenu,
 // sName argument is a title of the item,
 // id - menu item identifier; if 0 - it is created automatically
 // fu - a function in the program, which must be called, when this menu item is selected,
-// sCode - the identifier (name) of this function.
+// sCode - the identifier (name) of this function; if it is empty, a unique one is generated.
 // If the fu value is nil, sCode contains the Harbour's code, which must be executed by
 // the GuiServer when this menu item is selected.
 // params - arguments for the fu function.
-func AddMenuItem(sName string, id int, fu func([]string) string, sCode string, params ...string) {
-	
-	if sMenu[len(sMenu)-1] != '[' {
-		sMenu += ","
-	}
-	sMenu += "[\"" + sName + "\"," + getscode(fu, sCode, params...) + "," + strconv.Itoa(id) + "]"
+func (s *Session) AddMenuItem(sName string, id int, fu func([]string) string, sCode string, params ...string) {
+
+	s.addMenuEntry(protocol.MenuItem{Title: sName, Code: s.getscode(fu, sCode, params...), Id: id})
 }
 
 // AddCheckMenuItem is the same as AddMenuItem, but it creates a menu item, which may be checked.
 // In fact, it is needed in a GTK version only, but for the sake of compatibility it is
 // recommended to use it in your code if this is a check menu item.
-func AddCheckMenuItem(sName string, id int, fu func([]string) string, sCode string, params ...string) {
-	
-	if sMenu[len(sMenu)-1] != '[' {
-		sMenu += ","
-	}
-	sMenu += "[\"" + sName + "\"," + getscode(fu, sCode, params...) + "," + strconv.Itoa(id) + ",true]"
+func (s *Session) AddCheckMenuItem(sName string, id int, fu func([]string) string, sCode string, params ...string) {
+
+	s.addMenuEntry(protocol.MenuItem{Title: sName, Code: s.getscode(fu, sCode, params...), Id: id, Check: true})
 }
 
 // AddMenuSeparator adds a separator to the Window's menu or submenu,
-func AddMenuSeparator() {
-	if sMenu[len(sMenu)-1] != '[' {
-		sMenu += ","
-	}
-	sMenu += "[\"-\"]"
+func (s *Session) AddMenuSeparator() {
+	s.addMenuEntry(protocol.MenuSeparator{})
 }
 
 // MenuItemEnable enables (bValue == true) or disables a menu item.
 // If this is a window menu (main or a dialog), you need to pass the appropriate window name
 // via sWndName parameter, if context - the menu name via sMenuName.
 // iItem is a menu item id.
-func MenuItemEnable(sWndName string, sMenuName string, iItem int, bValue bool) {
+func (s *Session) MenuItemEnable(sWndName string, sMenuName string, iItem int, bValue bool) error {
 
-	sendout("[\"menu\",\"enable\",\"" + sWndName + "\",\"" + sMenuName + "\"," +
-		strconv.Itoa(iItem) + "," + strconv.FormatBool(bValue) + "]")
+	sParams := protocol.NewCmd("menu", "enable", sWndName, sMenuName, iItem, bValue)
+	s.recordMenuItem(sWndName, fmt.Sprintf("menu.%s.%s.%d", sWndName, sMenuName, iItem), sParams)
+	return s.sendout(sParams)
 }
 
 // MenuItemCheck checks (bValue == true) or unchecks a menu item.
@@ -119,8 +122,9 @@ func MenuItemEnable(sWndName string, sMenuName string, iItem int, bValue bool) {
 // via sWndName parameter, if context - the menu name via sMenuName.
 // iItem is a menu item id.
 
-func MenuItemCheck(sWndName string, sMenuName string, iItem int, bValue bool) {
+func (s *Session) MenuItemCheck(sWndName string, sMenuName string, iItem int, bValue bool) error {
 
-	sendout("[\"menu\",\"check\",\"" + sWndName + "\",\"" + sMenuName + "\"," +
-		strconv.Itoa(iItem) + "," + strconv.FormatBool(bValue) + "]")
+	sParams := protocol.NewCmd("menu", "check", sWndName, sMenuName, iItem, bValue)
+	s.recordMenuItem(sWndName, fmt.Sprintf("menu.%s.%s.%d", sWndName, sMenuName, iItem), sParams)
+	return s.sendout(sParams)
 }
@@ -0,0 +1,353 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Options structure describes, how to run and connect to a GuiServer.
+type Options struct {
+	Server         string        // A full path to GuiServer executable; if empty, the GuiServer isn't started
+	ServerArgs     []string      // Additional command line arguments for the GuiServer
+	Address        string        // An ip address of a computer, where GuiServer runs
+	Port           int           // A tcp/ip port number, Port+1 is used for the second connection
+	Type           int           // A connection type: TypeTCP, TypeFile, TypeUnix or TypePipe
+	Dir            string        // A directory for connection files or sockets (TypeFile, TypeUnix)
+	FileRoot       string        // A root name of connection files or sockets, "*" is replaced by a unique number
+	Log            int           // A GuiServer logging level: 0, 1 or 2
+	ConnectTimeout time.Duration // How long to try to connect to the GuiServer, 4 seconds by default
+	ReplyTimeout   time.Duration // How long to wait for a GuiServer reply, 0 - without a limit
+	ShutdownGrace  time.Duration // How long Exit waits for the GuiServer to finish before terminating it, 2 seconds by default
+	Reconnect      bool          // Restart or reconnect to the GuiServer after a connection loss and restore windows
+	MaxMessageSize int           // A maximum size of a message from the GuiServer, DefMaxMessageSize by default
+	Trace          string        // A file to write all messages to, in JSON lines format, see TraceRecord
+	Logger         *slog.Logger  // A logger of the session, the logger of the package (see SetLogger) by default
+
+	// AcceptProtocols are GuiServer protocol versions, which the program works with, []string{VerProto} by default.
+	// The protocol has no way to pass them to the GuiServer: a version, which the GuiServer sends,
+	// when the connection is established, is checked against this list.
+	AcceptProtocols []string
+	// Features set minimal GuiServer versions for features and widget types, overriding
+	// built-in ones, see Session.Supports; an empty version means, that all versions support it.
+	Features map[string]string
+
+	// Transport, if it isn't nil, creates transports instead of predefined ones:
+	// iChannel 0 is for messages of a program, 1 - for messages of a GuiServer.
+	Transport func(iChannel int) Transport
+}
+
+// Option is a function, which modifies Options. Options may be passed to Init and Dial.
+type Option func(*Options)
+
+// OptionError describes a wrong line, found by ParseOptions.
+type OptionError struct {
+	Line int    // A line number, starting from 1
+	Key  string // A key of the line, if it is recognized
+	Msg  string // The description of a problem
+}
+
+func (e *OptionError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("options: line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("options: line %d: %s: %s", e.Line, e.Key, e.Msg)
+}
+
+// DefaultOptions returns the Options, which are used by Init with an empty sOpt.
+func DefaultOptions() Options {
+	return Options{Server: "guiserver", Address: "127.0.0.1", Port: 3101, Type: 1, FileRoot: FileRoot,
+		ConnectTimeout: 4 * time.Second, ShutdownGrace: 2 * time.Second}
+}
+
+// WithServer sets a full path to GuiServer executable, an empty string means,
+// that the GuiServer is already running.
+func WithServer(sPath string) Option {
+	return func(o *Options) { o.Server = sPath }
+}
+
+// WithServerArgs adds command line arguments for the GuiServer.
+func WithServerArgs(args ...string) Option {
+	return func(o *Options) { o.ServerArgs = append(o.ServerArgs, args...) }
+}
+
+// WithAddress sets an ip address of a computer, where GuiServer runs.
+func WithAddress(sAddr string) Option {
+	return func(o *Options) { o.Address = sAddr }
+}
+
+// WithPort sets a tcp/ip port number.
+func WithPort(iPort int) Option {
+	return func(o *Options) { o.Port = iPort }
+}
+
+// WithType sets a connection type.
+func WithType(iType int) Option {
+	return func(o *Options) { o.Type = iType }
+}
+
+// WithDir sets a directory for connection files.
+func WithDir(sDir string) Option {
+	return func(o *Options) { o.Dir = sDir }
+}
+
+// WithFileRoot sets a root name of connection files.
+func WithFileRoot(sRoot string) Option {
+	return func(o *Options) { o.FileRoot = sRoot }
+}
+
+// WithLog sets a GuiServer logging level.
+func WithLog(iLevel int) Option {
+	return func(o *Options) { o.Log = iLevel }
+}
+
+// WithConnectTimeout sets, how long to try to connect to the GuiServer.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(o *Options) { o.ConnectTimeout = d }
+}
+
+// WithReplyTimeout sets, how long to wait for a GuiServer reply. After a timeout the connection
+// is closed, as a late reply would be taken for a reply to a next message; it is restored,
+// if Options.Reconnect is set.
+func WithReplyTimeout(d time.Duration) Option {
+	return func(o *Options) { o.ReplyTimeout = d }
+}
+
+// WithShutdownGrace sets, how long Exit waits for the GuiServer to finish before terminating it.
+func WithShutdownGrace(d time.Duration) Option {
+	return func(o *Options) { o.ShutdownGrace = d }
+}
+
+// WithMaxMessageSize sets a maximum size of a message from the GuiServer.
+func WithMaxMessageSize(iSize int) Option {
+	return func(o *Options) { o.MaxMessageSize = iSize }
+}
+
+// WithTransport sets a function, which creates transports for a GuiServer connection.
+func WithTransport(fu func(iChannel int) Transport) Option {
+	return func(o *Options) { o.Transport = fu }
+}
+
+// WithAcceptProtocols sets GuiServer protocol versions, which the program accepts.
+func WithAcceptProtocols(aVers ...string) Option {
+	return func(o *Options) { o.AcceptProtocols = aVers }
+}
+
+// WithFeature sets a minimal GuiServer version sMinVer for a feature or a widget type.
+func WithFeature(sFeature string, sMinVer string) Option {
+	return func(o *Options) {
+		if o.Features == nil {
+			o.Features = make(map[string]string)
+		}
+		o.Features[sFeature] = sMinVer
+	}
+}
+
+// WithLogger sets a logger of the session.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) { o.Logger = l }
+}
+
+// WithTrace sets a file to write all messages between the program and the GuiServer to.
+func WithTrace(sPath string) Option {
+	return func(o *Options) { o.Trace = sPath }
+}
+
+// WithReconnect turns on restoring the connection and windows after a connection loss.
+func WithReconnect(b bool) Option {
+	return func(o *Options) { o.Reconnect = b }
+}
+
+// ParseOptions reads options in a format of test.ini: one key=value pair in a line,
+// empty lines and lines, started with '#', are ignored. Keys are case insensitive:
+//
+//	guiserver=<full path to GuiServer executable, empty - don't start it>
+//	args=<additional GuiServer arguments, separated by spaces>
+//	address=<ip address of a computer, where GuiServer runs>
+//	port=<tcp/ip port number>
+//	type=<1 - tcp/ip, 2 - files, 3 - Unix domain sockets, 4 - pipes>
+//	dir=<a directory for connection files or sockets>
+//	file=<a root name of connection files or sockets>
+//	log=<0, 1 or 2> - logging level
+//	connecttimeout=<duration, 5s, for example>
+//	replytimeout=<duration>
+//	shutdowngrace=<duration>
+//	reconnect=<true or false>
+//	maxmessagesize=<a number of bytes>
+//	trace=<a file to write messages to>
+//	acceptprotocols=<GuiServer protocol versions, separated by commas>
+//	feature.<feature or widget type>=<a minimal GuiServer version>
+//
+// Values, which are absent, are taken from DefaultOptions().
+// Unknown keys and wrong values are reported as *OptionError, joined to one error;
+// the returned Options contain all correct values anyway.
+func ParseOptions(r io.Reader) (Options, error) {
+
+	var aErr []error
+	opts := DefaultOptions()
+
+	scanner := bufio.NewScanner(r)
+	iLine := 0
+	for scanner.Scan() {
+		iLine++
+		sLine := strings.TrimSpace(scanner.Text())
+		if sLine == "" || sLine[0] == '#' {
+			continue
+		}
+		npos := strings.Index(sLine, "=")
+		if npos == -1 {
+			aErr = append(aErr, &OptionError{Line: iLine, Msg: fmt.Sprintf("\"=\" is missing in %q", sLine)})
+			continue
+		}
+		sKey := strings.ToLower(strings.TrimSpace(sLine[:npos]))
+		sVal := strings.TrimSpace(sLine[npos+1:])
+		if err := opts.set(sKey, sVal); err != nil {
+			aErr = append(aErr, &OptionError{Line: iLine, Key: sKey, Msg: err.Error()})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		aErr = append(aErr, err)
+	}
+	return opts, errors.Join(aErr...)
+}
+
+func (o *Options) set(sKey, sVal string) error {
+
+	var err error
+	var i int
+	var d time.Duration
+
+	switch sKey {
+	case "guiserver":
+		o.Server = sVal
+	case "args":
+		o.ServerArgs = strings.Fields(sVal)
+	case "address":
+		o.Address = sVal
+	case "port":
+		if i, err = atoiRange(sVal, 1, 65534); err == nil {
+			o.Port = i
+		}
+	case "type":
+		if i, err = atoiRange(sVal, TypeTCP, TypePipe); err == nil {
+			o.Type = i
+		}
+	case "dir":
+		o.Dir = sVal
+	case "file":
+		o.FileRoot = sVal
+	case "log":
+		if i, err = atoiRange(sVal, 0, 2); err == nil {
+			o.Log = i
+		}
+	case "connecttimeout":
+		if d, err = time.ParseDuration(sVal); err == nil {
+			o.ConnectTimeout = d
+		}
+	case "replytimeout":
+		if d, err = time.ParseDuration(sVal); err == nil {
+			o.ReplyTimeout = d
+		}
+	case "shutdowngrace":
+		if d, err = time.ParseDuration(sVal); err == nil {
+			o.ShutdownGrace = d
+		}
+	case "maxmessagesize":
+		if i, err = atoiRange(sVal, 1, math.MaxInt32); err == nil {
+			o.MaxMessageSize = i
+		}
+	case "reconnect":
+		var b bool
+		if b, err = strconv.ParseBool(sVal); err == nil {
+			o.Reconnect = b
+		} else {
+			err = fmt.Errorf("%q is not a boolean value", sVal)
+		}
+	case "trace":
+		o.Trace = sVal
+	case "acceptprotocols":
+		o.AcceptProtocols = nil
+		for _, v := range strings.Split(sVal, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				o.AcceptProtocols = append(o.AcceptProtocols, v)
+			}
+		}
+		if o.AcceptProtocols == nil {
+			err = errors.New("no versions")
+		}
+	default:
+		if sFeature, bOk := strings.CutPrefix(sKey, "feature."); bOk && sFeature != "" {
+			if o.Features == nil {
+				o.Features = make(map[string]string)
+			}
+			o.Features[sFeature] = sVal
+			return nil
+		}
+		return errors.New("unknown key")
+	}
+	return err
+}
+
+func atoiRange(sVal string, iMin, iMax int) (int, error) {
+	i, err := strconv.Atoi(sVal)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", sVal)
+	}
+	if i < iMin || i > iMax {
+		return 0, fmt.Errorf("%d is out of range %d..%d", i, iMin, iMax)
+	}
+	return i, nil
+}
+
+// fileName returns a path to connection files or sockets without an extension.
+func (o *Options) fileName() string {
+	if o.Type != TypeFile && o.Type != TypeUnix {
+		return ""
+	}
+	return o.Dir + string(os.PathSeparator) + o.FileRoot
+}
+
+func (o *Options) setDefaults() {
+	if o.Address == "" {
+		o.Address = "127.0.0.1"
+	}
+	if o.Port == 0 {
+		o.Port = 3101
+	}
+	if o.Type == 0 {
+		o.Type = 1
+	}
+	if o.FileRoot == "" {
+		o.FileRoot = FileRoot
+	}
+	if strings.Contains(o.FileRoot, "*") {
+		sz := strconv.Itoa(int((time.Now().UnixNano() / 1000000) % 100000))
+		o.FileRoot = strings.Replace(o.FileRoot, "*", sz, -1)
+	}
+	if (o.Type == TypeFile || o.Type == TypeUnix) && o.Dir == "" {
+		o.Dir = os.TempDir()
+	}
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = 4 * time.Second
+	}
+	if o.MaxMessageSize == 0 {
+		o.MaxMessageSize = DefMaxMessageSize
+	}
+	if o.ShutdownGrace == 0 {
+		o.ShutdownGrace = 2 * time.Second
+	}
+	if len(o.AcceptProtocols) == 0 {
+		o.AcceptProtocols = []string{VerProto}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+)
+
+// optionErrors returns errors, joined by ParseOptions.
+func optionErrors(t *testing.T, err error) []*egui.OptionError {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	aErrs := []error{err}
+	if j, bOk := err.(interface{ Unwrap() []error }); bOk {
+		aErrs = j.Unwrap()
+	}
+	var aRes []*egui.OptionError
+	for _, e := range aErrs {
+		var oerr *egui.OptionError
+		if !errors.As(e, &oerr) {
+			t.Fatalf("%v is not an *OptionError", e)
+		}
+		aRes = append(aRes, oerr)
+	}
+	return aRes
+}
+
+func TestParseOptionsLines(t *testing.T) {
+	for _, tc := range []struct {
+		sName  string
+		sText  string
+		aLines []int
+		aKeys  []string
+	}{
+		{"empty", "", nil, nil},
+		{"correct", "# comment\nport=3200\n\nreplytimeout = 2s\n", nil, nil},
+		{"no equal sign", "port=3200\nguiserver\n", []int{2}, []string{""}},
+		{"unknown key", "\n\nfoo=1\n", []int{3}, []string{"foo"}},
+		{"wrong values", "port=0\n# comment\ntype=9\nreplytimeout=2\nreconnect=maybe\n",
+			[]int{1, 3, 4, 5}, []string{"port", "type", "replytimeout", "reconnect"}},
+		{"crlf", "port=3200\r\nlog=7\r\n", []int{2}, []string{"log"}},
+		{"no versions", "acceptprotocols= , \n", []int{1}, []string{"acceptprotocols"}},
+	} {
+		t.Run(tc.sName, func(t *testing.T) {
+			_, err := egui.ParseOptions(strings.NewReader(tc.sText))
+			aErrs := optionErrors(t, err)
+			if len(aErrs) != len(tc.aLines) {
+				t.Fatalf("%d errors (%v), want %d", len(aErrs), err, len(tc.aLines))
+			}
+			for i, e := range aErrs {
+				if e.Line != tc.aLines[i] || e.Key != tc.aKeys[i] {
+					t.Errorf("error %d: line %d, key %q, want line %d, key %q",
+						i, e.Line, e.Key, tc.aLines[i], tc.aKeys[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseOptionsValues(t *testing.T) {
+	opts, err := egui.ParseOptions(strings.NewReader(
+		"port=3200\nfoo=1\nReplyTimeout=2s\nfeature.set.destroy=1.4\nacceptprotocols=1, 2\n"))
+	if len(optionErrors(t, err)) != 1 {
+		t.Fatalf("errors: %v", err)
+	}
+	if opts.Port != 3200 || opts.ReplyTimeout != 2*time.Second {
+		t.Errorf("port %d, reply timeout %v", opts.Port, opts.ReplyTimeout)
+	}
+	if opts.Features["set.destroy"] != "1.4" {
+		t.Errorf("features %v", opts.Features)
+	}
+	if strings.Join(opts.AcceptProtocols, ",") != "1,2" {
+		t.Errorf("protocols %v", opts.AcceptProtocols)
+	}
+	if opts.Server != egui.DefaultOptions().Server {
+		t.Errorf("server %q isn't a default one", opts.Server)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// srvProcess is a GuiServer process, started by a session.
+type srvProcess struct {
+	cmd    *exec.Cmd
+	chDone chan struct{}
+	err    error
+
+	pOut, pIn *pipeTransport // TypePipe transports
+}
+
+// logWriter writes an output of the GuiServer process to the log line by line.
+type logWriter struct {
+	pLog  *slog.Logger
+	sName string
+	buf   []byte
+	mux   sync.Mutex
+}
+
+func (w *logWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.buf = append(w.buf, b...)
+	for {
+		npos := bytes.IndexByte(w.buf, '\n')
+		if npos == -1 {
+			break
+		}
+		w.pLog.Info("guiserver output", "stream", w.sName, "text", string(bytes.TrimRight(w.buf[:npos], "\r")))
+		w.buf = w.buf[npos+1:]
+	}
+	return len(b), nil
+}
+
+// startServer runs the GuiServer executable, defined in opts.
+func (s *Session) startServer(opts Options) error {
+
+	args := []string{fmt.Sprintf("-p%d", opts.Port), fmt.Sprintf("-t%d", opts.Type)}
+	if opts.Log == 1 || opts.Log == 2 {
+		args = append(args, fmt.Sprintf("-log%d", opts.Log))
+	}
+	if opts.Type == TypeFile || opts.Type == TypeUnix {
+		args = append(args, "-d"+opts.Dir, "-f"+opts.FileRoot)
+	}
+	cmd := exec.Command(opts.Server, append(args, opts.ServerArgs...)...)
+	cmd.Stdout = &logWriter{pLog: s.logger(), sName: "stdout"}
+	cmd.Stderr = &logWriter{pLog: s.logger(), sName: "stderr"}
+	setProcAttr(cmd)
+
+	pProc := &srvProcess{cmd: cmd, chDone: make(chan struct{})}
+	var aChild []*os.File
+	if opts.Type == TypePipe && opts.Transport == nil {
+		// stdout is used by the protocol, only stderr goes to the log
+		var err error
+		if pProc.pOut, pProc.pIn, aChild, err = newPipes(opts.ReplyTimeout, opts.MaxMessageSize); err != nil {
+			return fmt.Errorf("%w: %v", ErrServerStartFailed, err)
+		}
+		cmd.Stdin, cmd.Stdout = aChild[0], aChild[1]
+		cmd.ExtraFiles = aChild[2:]
+	}
+	// On Linux the GuiServer gets a signal, when the thread, which started it, exits
+	// (see setProcAttr), so it is started and waited for by a goroutine, which keeps its thread.
+	chStart := make(chan error)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		err := cmd.Start()
+		chStart <- err
+		if err != nil {
+			return
+		}
+		pProc.err = cmd.Wait()
+		if pProc.err != nil {
+			s.logger().Warn("GuiServer exited", "err", pProc.err)
+		}
+		close(pProc.chDone)
+	}()
+	err := <-chStart
+	for _, f := range aChild {
+		f.Close()
+	}
+	if err != nil {
+		if pProc.pOut != nil {
+			pProc.pOut.Close()
+			pProc.pIn.Close()
+		}
+		s.logger().Error("can't start GuiServer", "path", opts.Server, "err", err)
+		return fmt.Errorf("%w: %v", ErrServerStartFailed, err)
+	}
+
+	s.mux.Lock()
+	s.pProc = pProc
+	s.mux.Unlock()
+	return nil
+}
+
+// stopServer waits for the GuiServer process to exit during the dGrace period,
+// then terminates it.
+func (s *Session) stopServer(dGrace time.Duration) {
+
+	s.mux.Lock()
+	pProc := s.pProc
+	s.mux.Unlock()
+	if pProc == nil {
+		return
+	}
+
+	select {
+	case <-pProc.chDone:
+		return
+	default:
+	}
+	t := time.NewTimer(dGrace)
+	defer t.Stop()
+	select {
+	case <-pProc.chDone:
+		return
+	case <-t.C:
+	}
+	s.logger().Warn("GuiServer doesn't exit, terminating it")
+	terminate(pProc.cmd)
+	select {
+	case <-pProc.chDone:
+	case <-time.After(time.Second):
+		pProc.cmd.Process.Kill()
+	}
+}
+
+// watch closes the session, when ctx is cancelled.
+func (s *Session) watch(ctx context.Context, chDone chan struct{}) {
+	select {
+	case <-ctx.Done():
+		s.logger().Info("context is done, closing the session")
+		s.Exit()
+	case <-chDone:
+	}
+}
+
+// Done returns a channel, which is closed, when the GuiServer process, started by
+// the session, exits. If the session didn't start the GuiServer, the channel
+// is closed, when the application ends.
+func (s *Session) Done() <-chan struct{} {
+	s.mux.Lock()
+	pProc := s.pProc
+	s.mux.Unlock()
+	if pProc != nil {
+		return pProc.chDone
+	}
+	s.muxQueue.Lock()
+	defer s.muxQueue.Unlock()
+	return s.chDone
+}
+
+// Err returns an error, which the GuiServer process exited with,
+// or nil, if it exited successfully, is still running or wasn't started by the session.
+func (s *Session) Err() error {
+	s.mux.Lock()
+	pProc := s.pProc
+	s.mux.Unlock()
+	if pProc == nil {
+		return nil
+	}
+	select {
+	case <-pProc.chDone:
+		return pProc.err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,17 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcAttr asks the kernel to terminate the GuiServer, if the program dies.
+// The signal is sent, when a thread, which started the process, exits,
+// so startServer keeps the thread locked, until the process exits.
+func setProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+}
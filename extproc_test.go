@@ -0,0 +1,84 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+// stubServer writes a shell script, which is started instead of a GuiServer
+// and exits with a code iCode, when a file, which path it returns, is created.
+func stubServer(t *testing.T, iCode int) (sPath string, sStop string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("a stub GuiServer is a shell script")
+	}
+	sDir := t.TempDir()
+	sPath, sStop = filepath.Join(sDir, "guiserver"), filepath.Join(sDir, "stop")
+	sScript := "#!/bin/sh\nwhile [ ! -f " + sStop + " ]; do sleep 0.05; done\nexit " + strconv.Itoa(iCode) + "\n"
+	if err := os.WriteFile(sPath, []byte(sScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return sPath, sStop
+}
+
+func TestServerProcess(t *testing.T) {
+	for _, iCode := range []int{0, 3} {
+		sPath, sStop := stubServer(t, iCode)
+		srv := externaltest.NewServer()
+		// The session is opened by a goroutine, which thread exits with it,
+		// the process must not get a Pdeathsig signal then.
+		opts := srv.Pipe()
+		opts.Server = sPath
+		chErr := make(chan error)
+		var s *egui.Session
+		go func() {
+			runtime.LockOSThread()
+			var err error
+			s, err = egui.Dial(context.Background(), opts, egui.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			chErr <- err
+		}()
+		if err := <-chErr; err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			s.Exit()
+			srv.Close()
+		})
+
+		select {
+		case <-s.Done():
+			t.Fatalf("code %d: Done is closed, while the process runs", iCode)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if err := s.Err(); err != nil {
+			t.Errorf("code %d: Err %v, while the process runs", iCode, err)
+		}
+
+		os.WriteFile(sStop, nil, 0644)
+		select {
+		case <-s.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("code %d: Done isn't closed", iCode)
+		}
+		var errExit *exec.ExitError
+		if err := s.Err(); iCode == 0 && err != nil || iCode != 0 && (!errors.As(err, &errExit) || errExit.ExitCode() != iCode) {
+			t.Errorf("code %d: Err %v", iCode, err)
+		}
+	}
+}
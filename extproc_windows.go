@@ -0,0 +1,16 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"os/exec"
+)
+
+func setProcAttr(cmd *exec.Cmd) {
+}
+
+func terminate(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,391 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"fmt"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// WidgetProps is implemented by typed properties of widgets (ComboProps, SplitterProps, etc.),
+// which are set in a Props member of a Widget structure instead of AProps:
+//
+//	pWnd.AddWidget(&egui.Widget{Type: "combo", X: 20, Y: 20, W: 160, H: 24,
+//		Props: &egui.ComboProps{Items: []string{"first", "second"}}})
+//
+// Logical properties are sent, if they are true, numeric ones - if they aren't 0,
+// so the GuiServer defaults are used for zero values.
+type WidgetProps interface {
+	// props returns properties for a widget of a type sType or an error,
+	// if they don't belong to this type.
+	props(sType string) (protocol.Props, error)
+}
+
+// WindowProps are properties of "main" and "dialog" windows.
+type WindowProps struct {
+	Icon        string // A path to an icon or a resource name
+	NoExitOnEsc bool   // A dialog isn't closed by Esc
+	NoCloseAble bool   // A dialog hasn't a close button
+}
+
+func (p *WindowProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "main", "dialog"); err != nil {
+		return nil, err
+	}
+	if sType == "main" && (p.NoExitOnEsc || p.NoCloseAble) {
+		return nil, fmt.Errorf("%w: NoExitOnEsc and NoCloseAble are for dialogs only", ErrWrongProps)
+	}
+	props := protocol.Props{}
+	propStr(props, "Icon", p.Icon)
+	propBool(props, "NoExitOnEsc", p.NoExitOnEsc)
+	propBool(props, "NoCloseAble", p.NoCloseAble)
+	return props, nil
+}
+
+// LabelProps are properties of "label", "check" and "radio" widgets.
+type LabelProps struct {
+	Transpa bool // A transparent background
+}
+
+func (p *LabelProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "label", "check", "radio"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propBool(props, "Transpa", p.Transpa)
+	return props, nil
+}
+
+// EditProps are properties of an "edit" widget.
+type EditProps struct {
+	Picture string // A Harbour picture: "@!R /XXX:XXX/", "D@D", etc.
+}
+
+func (p *EditProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "edit"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propStr(props, "Picture", p.Picture)
+	return props, nil
+}
+
+// ComboProps are properties of a "combo" widget.
+type ComboProps struct {
+	Items []string // Items of a list
+}
+
+func (p *ComboProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "combo"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	if p.Items != nil {
+		props["AItems"] = p.Items
+	}
+	return props, nil
+}
+
+// BitmapProps are properties of a "bitmap" widget.
+type BitmapProps struct {
+	Image   string // A path to an image
+	Transpa bool   // A transparent background
+	TrColor int32  // A color, which is considered transparent
+}
+
+func (p *BitmapProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "bitmap"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propStr(props, "Image", p.Image)
+	propBool(props, "Transpa", p.Transpa)
+	propNum(props, "TrColor", int(p.TrColor))
+	return props, nil
+}
+
+// LineProps are properties of a "line" widget.
+type LineProps struct {
+	Vertical bool
+}
+
+func (p *LineProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "line"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propBool(props, "Vertical", p.Vertical)
+	return props, nil
+}
+
+// PanelProps are properties of "panel", "paneltop" and "panelbot" widgets.
+type PanelProps struct {
+	Style *Style // A style of a panel, created by CreateStyle
+	Parts []int  // Widths of parts of a "panelbot" (a status bar), 0 - up to the end
+}
+
+func (p *PanelProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "panel", "paneltop", "panelbot"); err != nil {
+		return nil, err
+	}
+	if p.Parts != nil && sType != "panelbot" {
+		return nil, fmt.Errorf("%w: Parts are for \"panelbot\" only", ErrWrongProps)
+	}
+	props := protocol.Props{}
+	propStyle(props, "HStyle", p.Style)
+	if p.Parts != nil {
+		props["AParts"] = p.Parts
+	}
+	return props, nil
+}
+
+// PanelHeadProps are properties of a "panelhead" widget.
+type PanelHeadProps struct {
+	Style    *Style // A style of a panel, created by CreateStyle
+	Xt, Yt   int    // A position of a title
+	BtnClose bool   // Buttons of a window
+	BtnMax   bool
+	BtnMin   bool
+}
+
+func (p *PanelHeadProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "panelhead"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propStyle(props, "HStyle", p.Style)
+	propNum(props, "Xt", p.Xt)
+	propNum(props, "Yt", p.Yt)
+	propBool(props, "BtnClose", p.BtnClose)
+	propBool(props, "BtnMax", p.BtnMax)
+	propBool(props, "BtnMin", p.BtnMin)
+	return props, nil
+}
+
+// OwnBtnProps are properties of an "ownbtn" widget.
+type OwnBtnProps struct {
+	Image   string   // A path to an image
+	Transpa bool     // A transparent background
+	TrColor int32    // A color, which is considered transparent
+	Styles  []*Style // Styles of a button: normal, pressed and under a cursor
+	Xt, Yt  int      // A position of a title
+}
+
+func (p *OwnBtnProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "ownbtn"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propStr(props, "Image", p.Image)
+	propBool(props, "Transpa", p.Transpa)
+	propNum(props, "TrColor", int(p.TrColor))
+	if p.Styles != nil {
+		aNames := make([]string, len(p.Styles))
+		for i, pStyle := range p.Styles {
+			if pStyle == nil {
+				return nil, fmt.Errorf("%w: Styles[%d] is nil", ErrWrongProps, i)
+			}
+			aNames[i] = pStyle.Name
+		}
+		props["HStyles"] = aNames
+	}
+	propNum(props, "Xt", p.Xt)
+	propNum(props, "Yt", p.Yt)
+	return props, nil
+}
+
+// SplitterProps are properties of a "splitter" widget.
+type SplitterProps struct {
+	Vertical bool
+	From, To int       // Limits of a splitter position
+	Left     []*Widget // Widgets at the left (top) side, which are resized with a splitter
+	Right    []*Widget // Widgets at the right (bottom) side
+	Style    *Style
+}
+
+func (p *SplitterProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "splitter"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propBool(props, "Vertical", p.Vertical)
+	propNum(props, "From", p.From)
+	propNum(props, "TO", p.To)
+	for _, side := range []struct {
+		sName  string
+		aWidgs []*Widget
+	}{{"ALeft", p.Left}, {"ARight", p.Right}} {
+		if side.aWidgs == nil {
+			continue
+		}
+		aNames := make([]string, len(side.aWidgs))
+		for i, pWidg := range side.aWidgs {
+			if pWidg == nil {
+				return nil, fmt.Errorf("%w: %s[%d] is nil", ErrWrongProps, side.sName[1:], i)
+			}
+			aNames[i] = pWidg.Name
+		}
+		props[side.sName] = aNames
+	}
+	propStyle(props, "HStyle", p.Style)
+	return props, nil
+}
+
+// UpDownProps are properties of an "updown" widget.
+type UpDownProps struct {
+	From, To int // A range of values
+}
+
+func (p *UpDownProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "updown"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propNum(props, "From", p.From)
+	propNum(props, "TO", p.To)
+	return props, nil
+}
+
+// TreeProps are properties of a "tree" widget.
+type TreeProps struct {
+	Images    []string // Paths to images of nodes
+	EditLabel bool     // Titles of nodes may be edited
+}
+
+func (p *TreeProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "tree"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	if p.Images != nil {
+		props["AImages"] = p.Images
+	}
+	propBool(props, "EditLabel", p.EditLabel)
+	return props, nil
+}
+
+// ProgressProps are properties of a "progress" widget.
+type ProgressProps struct {
+	MaxPos int // A maximal position
+}
+
+func (p *ProgressProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "progress"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propNum(props, "Maxpos", p.MaxPos)
+	return props, nil
+}
+
+// BrowseProps are properties of a "browse" widget.
+type BrowseProps struct {
+	Append    bool // New rows may be appended
+	AutoEdit  bool // Cells are edited by typing
+	NoVScroll bool
+	NoBorder  bool
+}
+
+func (p *BrowseProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "browse"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propBool(props, "Append", p.Append)
+	propBool(props, "Autoedit", p.AutoEdit)
+	propBool(props, "NoVScroll", p.NoVScroll)
+	propBool(props, "NoBorder", p.NoBorder)
+	return props, nil
+}
+
+// CodeEditProps are properties of a "cedit" widget.
+type CodeEditProps struct {
+	NoVScroll bool
+	NoBorder  bool
+}
+
+func (p *CodeEditProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "cedit"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propBool(props, "NoVScroll", p.NoVScroll)
+	propBool(props, "NoBorder", p.NoBorder)
+	return props, nil
+}
+
+// LinkProps are properties of a "link" widget.
+type LinkProps struct {
+	Link       string // An url
+	ClrVisited int32  // Colors of a link
+	ClrLink    int32
+	ClrOver    int32
+}
+
+func (p *LinkProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "link"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propStr(props, "Link", p.Link)
+	propNum(props, "ClrVisited", int(p.ClrVisited))
+	propNum(props, "ClrLink", int(p.ClrLink))
+	propNum(props, "ClrOver", int(p.ClrOver))
+	return props, nil
+}
+
+// MonthCalProps are properties of a "monthcal" widget.
+type MonthCalProps struct {
+	NoToday     bool
+	NoTodayCirc bool
+	WeekNumb    bool // Week numbers are shown
+}
+
+func (p *MonthCalProps) props(sType string) (protocol.Props, error) {
+	if err := propsType(p, sType, "monthcal"); err != nil {
+		return nil, err
+	}
+	props := protocol.Props{}
+	propBool(props, "NoToday", p.NoToday)
+	propBool(props, "NoTodayCirc", p.NoTodayCirc)
+	propBool(props, "WeekNumb", p.WeekNumb)
+	return props, nil
+}
+
+// propsType returns an error, if properties p aren't for a widget type sType.
+func propsType(p WidgetProps, sType string, aTypes ...string) error {
+	for _, s := range aTypes {
+		if s == sType {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %T is not for \"%s\"", ErrWrongProps, p, sType)
+}
+
+func propStr(props protocol.Props, sName string, s string) {
+	if s != "" {
+		props[sName] = s
+	}
+}
+
+// propBool sets a logical property, it is sent as "t", as the GuiServer expects.
+func propBool(props protocol.Props, sName string, b bool) {
+	if b {
+		props[sName] = "t"
+	}
+}
+
+func propNum(props protocol.Props, sName string, n int) {
+	if n != 0 {
+		props[sName] = n
+	}
+}
+
+func propStyle(props protocol.Props, sName string, pStyle *Style) {
+	if pStyle != nil {
+		props[sName] = pStyle.Name
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alkresin/external/internal/protocol"
+)
+
+// replayLog keeps messages, which create and modify GUI elements, in order they were sent.
+// A message with a key replaces a previous message with the same key,
+// so only the last state of a property is kept; a message without a key is appended.
+type replayLog struct {
+	aMsg   []protocol.Msg
+	aOwner []string // full names of widgets, which messages belong to, "" for windows and the session
+	mIdx   map[string]int
+}
+
+func (r *replayLog) put(sOwner string, sKey string, m protocol.Msg) {
+	if sKey != "" {
+		if i, bOk := r.mIdx[sKey]; bOk {
+			r.aMsg[i] = m
+			return
+		}
+		if r.mIdx == nil {
+			r.mIdx = make(map[string]int)
+		}
+		r.mIdx[sKey] = len(r.aMsg)
+	}
+	r.aMsg = append(r.aMsg, m)
+	r.aOwner = append(r.aOwner, sOwner)
+}
+
+// drop removes messages of a widget sName and of its children.
+func (r *replayLog) drop(sName string) {
+	aNew := make([]int, len(r.aMsg))
+	j := 0
+	for i, sOwner := range r.aOwner {
+		if sOwner == sName || strings.HasPrefix(sOwner, sName+".") {
+			aNew[i] = -1
+			continue
+		}
+		aNew[i] = j
+		r.aMsg[j], r.aOwner[j] = r.aMsg[i], sOwner
+		j++
+	}
+	clear(r.aMsg[j:])
+	r.aMsg, r.aOwner = r.aMsg[:j], r.aOwner[:j]
+	for sKey, i := range r.mIdx {
+		if aNew[i] < 0 {
+			delete(r.mIdx, sKey)
+		} else {
+			r.mIdx[sKey] = aNew[i]
+		}
+	}
+}
+
+// window returns a main window or a dialog, which the widget o belongs to.
+func (o *Widget) window() *Widget {
+	for o.Parent != nil {
+		o = o.Parent
+	}
+	return o
+}
+
+// record keeps a message m to send it again after reconnecting, if Options.Reconnect is set.
+// Messages for widgets are kept in their window, so they are dropped with it;
+// if pWidg is nil, the message belongs to the session (fonts, styles, etc.).
+func (s *Session) record(pWidg *Widget, sKey string, m protocol.Msg) {
+
+	if !s.opts.Reconnect {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if pWidg == nil {
+		s.rlog.put("", sKey, m)
+		return
+	}
+	var sOwner string
+	if pWidg.Parent != nil {
+		sOwner = widgFullName(pWidg)
+	}
+	pWnd := pWidg.window()
+	if pWnd.rlog == nil {
+		pWnd.rlog = &replayLog{}
+	}
+	pWnd.rlog.put(sOwner, sKey, m)
+}
+
+// unrecord removes recorded messages of a widget o and of its children, when it is destroyed.
+func (s *Session) unrecord(o *Widget) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if pWnd := o.window(); pWnd.rlog != nil {
+		pWnd.rlog.drop(widgFullName(o))
+	}
+}
+
+// lastWnd returns the last created window, which a menu belongs to.
+func (s *Session) lastWnd() *Widget {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.pLastWnd
+}
+
+// recordMenuItem records a state of a menu item; it belongs to a window sWndName
+// or, for context menus, to the last created window, as the menu itself.
+func (s *Session) recordMenuItem(sWndName string, sKey string, m protocol.Msg) {
+	var pWnd *Widget
+	if sWndName != "" {
+		pWnd = s.Wnd(sWndName)
+	}
+	if pWnd == nil {
+		pWnd = s.lastWnd()
+	}
+	s.record(pWnd, sKey, m)
+}
+
+// mainWnd returns the main window of the session.
+func (s *Session) mainWnd() *Widget {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.pMainWindow
+}
+
+// replay sends all recorded messages to a new GuiServer: session-wide ones first,
+// then a main window and dialogs. muxOut must be locked.
+func (s *Session) replay() error {
+
+	s.mux.Lock()
+	aMsg := append([]protocol.Msg{}, s.rlog.aMsg...)
+	if s.pMainWindow != nil && s.pMainWindow.rlog != nil {
+		aMsg = append(aMsg, s.pMainWindow.rlog.aMsg...)
+	}
+	for _, pDlg := range s.aDialogs {
+		if pDlg.rlog != nil {
+			aMsg = append(aMsg, pDlg.rlog.aMsg...)
+		}
+	}
+	s.mux.Unlock()
+
+	for _, m := range aMsg {
+		b, err := protocol.Marshal(m)
+		if err != nil {
+			s.logger().Error("can't replay a message", "err", err)
+			continue
+		}
+		if b, err = s.exchange(b); err != nil {
+			return err
+		}
+		if err = checkReply(b); err != nil {
+			s.logger().Warn("replayed message is rejected", "cmd", cmdOf(m), "err", err)
+		}
+	}
+	return nil
+}
+
+// reconnect is called by listen, when a connection pIn is lost and Options.Reconnect is set.
+// It restarts the GuiServer, if it was started by the session, connects to it
+// and restores fonts, styles, windows, widgets, menus and last known texts. It tries to do it until
+// it succeeds, Exit is called or the GuiServer has an unacceptable protocol version.
+// Windows, created from xml forms, printers and progress bar steps (PBarStep) are not restored.
+// Only one reconnect works at a time; if pIn was replaced already by the other one, it does nothing.
+func (s *Session) reconnect(pIn Transport) {
+
+	s.muxReconn.Lock()
+	defer s.muxReconn.Unlock()
+	s.muxOut.Lock()
+	bLost := s.pConnIn == pIn
+	s.muxOut.Unlock()
+	if !bLost || !s.bConnExist.CompareAndSwap(true, false) {
+		// The session is restored already or closed by Exit.
+		return
+	}
+	s.bReconnecting.Store(true)
+	defer s.bReconnecting.Store(false)
+	s.logger().Warn("connection to GuiServer is lost, reconnecting")
+	s.pConnOut.Close()
+	s.pConnIn.Close()
+
+	opts := s.opts
+	sFileName := opts.fileName()
+	for s.ctxSess.Err() == nil {
+		var err error
+		if opts.Server != "" {
+			s.stopServer(0)
+			if opts.Type == TypeFile {
+				os.Remove(sFileName)
+			}
+			err = s.startServer(opts)
+		}
+		if err == nil {
+			s.muxOut.Lock()
+			if err = s.connect(s.ctxSess, opts, sFileName); err == nil {
+				if err = s.replay(); err == nil {
+					s.muxOut.Unlock()
+					s.logger().Info("reconnected to GuiServer")
+					return
+				}
+			}
+			s.muxOut.Unlock()
+		}
+		var errVer *ErrProtocolMismatch
+		if errors.As(err, &errVer) {
+			s.logger().Error("reconnect is stopped", "err", err)
+			break
+		}
+		s.logger().Warn("reconnect failed", "err", err)
+		if s.bConnExist.CompareAndSwap(true, false) {
+			// The connection is established, but lost while replaying;
+			// listen of it calls reconnect, which returns, as pIn is other.
+			s.pConnOut.Close()
+			s.pConnIn.Close()
+		}
+		sleepCtx(s.ctxSess, time.Second)
+	}
+	s.stopServer(0)
+	s.finish()
+}
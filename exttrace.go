@@ -0,0 +1,267 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Directions of trace records.
+const (
+	TraceOut    = "out"    // A message of the program (the first channel)
+	TraceReply  = "reply"  // A GuiServer reply to a message of the program, the handshake line also
+	TraceEvent  = "event"  // A message of the GuiServer (the second channel), the handshake line also
+	TraceAnswer = "answer" // A reply of the program to a message of the GuiServer
+	TraceError  = "error"  // A connection error
+)
+
+// TraceRecord is one line of a trace file, which is written, if Options.Trace is set.
+// Msg is a message without the protocol framing.
+type TraceRecord struct {
+	Time    time.Time `json:"time"`
+	Dir     string    `json:"dir"`
+	Channel int       `json:"ch"`
+	Msg     string    `json:"msg"`
+}
+
+// tracer writes trace records to a file in JSON lines format.
+type tracer struct {
+	mux  sync.Mutex
+	f    *os.File
+	enc  *json.Encoder
+	pLog *slog.Logger
+}
+
+func newTracer(sPath string, pLog *slog.Logger) (*tracer, error) {
+	f, err := os.Create(sPath)
+	if err != nil {
+		return nil, err
+	}
+	return &tracer{f: f, enc: json.NewEncoder(f), pLog: pLog}, nil
+}
+
+func (t *tracer) write(sDir string, iChannel int, sMsg string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.f == nil {
+		return
+	}
+	if err := t.enc.Encode(TraceRecord{Time: time.Now(), Dir: sDir, Channel: iChannel, Msg: sMsg}); err != nil {
+		t.pLog.Error("can't write a trace", "err", err)
+	}
+}
+
+func (t *tracer) Close() error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.f == nil {
+		return nil
+	}
+	err := t.f.Close()
+	t.f = nil
+	return err
+}
+
+// wrap returns a Transport, which writes all messages, passing through p, to the trace.
+func (t *tracer) wrap(p Transport, iChannel int) Transport {
+	return &traceTransport{Transport: p, pTrace: t, iChannel: iChannel}
+}
+
+type traceTransport struct {
+	Transport
+	pTrace   *tracer
+	iChannel int
+}
+
+func (p *traceTransport) ReadMsg() ([]byte, error) {
+	b, err := p.Transport.ReadMsg()
+	if err != nil {
+		p.pTrace.write(TraceError, p.iChannel, err.Error())
+	} else if p.iChannel == 0 {
+		p.pTrace.write(TraceReply, p.iChannel, string(b))
+	} else {
+		p.pTrace.write(TraceEvent, p.iChannel, string(b))
+	}
+	return b, err
+}
+
+func (p *traceTransport) WriteMsg(b []byte) error {
+	if p.iChannel == 0 {
+		p.pTrace.write(TraceOut, p.iChannel, string(b))
+	} else {
+		p.pTrace.write(TraceAnswer, p.iChannel, string(b))
+	}
+	return p.Transport.WriteMsg(b)
+}
+
+// ReadTrace reads a trace file, written by a session with Options.Trace set.
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+
+	var aRec []TraceRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, DefMaxMessageSize*2)
+	for scanner.Scan() {
+		var rec TraceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("trace: line %d: %w", len(aRec)+1, err)
+		}
+		aRec = append(aRec, rec)
+	}
+	return aRec, scanner.Err()
+}
+
+// Replay returns a function for Options.Transport, which plays a GuiServer role, using
+// a trace aRec: it replies to messages of a program with recorded replies and sends
+// recorded GuiServer messages, keeping their order relatively to messages of the program.
+// So a program may be run with a trace of a user's session to reproduce a problem without
+// a GuiServer. Messages of the program, which differ from recorded ones, are written to the log.
+// If the program doesn't follow the trace for tStall (10 seconds, if it is 0),
+// blocking records are skipped. A trace with a reconnect can't be replayed.
+func Replay(aRec []TraceRecord, tStall time.Duration) func(iChannel int) Transport {
+
+	if tStall == 0 {
+		tStall = 10 * time.Second
+	}
+	r := &replayer{tStall: tStall}
+	for _, rec := range aRec {
+		if rec.Dir != TraceError {
+			r.aRec = append(r.aRec, rec)
+		}
+	}
+	r.cond = sync.NewCond(&r.mux)
+	return func(iChannel int) Transport {
+		return &replayTransport{r: r, iChannel: iChannel}
+	}
+}
+
+// replayer keeps a position in a trace, which is shared by both channels.
+type replayer struct {
+	mux     sync.Mutex
+	cond    *sync.Cond
+	aRec    []TraceRecord
+	iPos    int
+	tStall  time.Duration
+	bClosed bool
+	pLog    *slog.Logger
+}
+
+// next waits, until a next record has a direction sDir, and returns it.
+// Answers of the program don't block the first channel, they are skipped.
+// r.mux must be locked.
+func (r *replayer) next(sDir string, iChannel int) (TraceRecord, error) {
+
+	tStart := time.Now()
+	iPos := r.iPos
+	for {
+		if r.bClosed {
+			return TraceRecord{}, net.ErrClosed
+		}
+		for iChannel == 0 && r.iPos < len(r.aRec) && r.aRec[r.iPos].Dir == TraceAnswer {
+			r.iPos++
+		}
+		if r.iPos >= len(r.aRec) {
+			if iChannel == 0 {
+				return TraceRecord{}, io.EOF
+			}
+		} else if rec := r.aRec[r.iPos]; rec.Dir == sDir && rec.Channel == iChannel {
+			r.iPos++
+			r.cond.Broadcast()
+			return rec, nil
+		} else if iPos != r.iPos {
+			// Other channel has moved, wait more
+			tStart, iPos = time.Now(), r.iPos
+		} else if iChannel == 0 && time.Since(tStart) > r.tStall {
+			logOr(r.pLog).Warn("replay: a record is skipped", "dir", rec.Dir, "msg", rec.Msg)
+			r.iPos++
+			r.cond.Broadcast()
+			continue
+		}
+		if iChannel == 0 {
+			// The first channel is waked periodically to check a stall
+			tm := time.AfterFunc(100*time.Millisecond, func() {
+				r.mux.Lock()
+				r.cond.Broadcast()
+				r.mux.Unlock()
+			})
+			r.cond.Wait()
+			tm.Stop()
+		} else {
+			r.cond.Wait()
+		}
+	}
+}
+
+type replayTransport struct {
+	r        *replayer
+	iChannel int
+}
+
+// Dial does nothing, the trace is ready.
+func (p *replayTransport) Dial(ctx context.Context) error {
+	return nil
+}
+
+func (p *replayTransport) ReadMsg() ([]byte, error) {
+
+	sDir := TraceReply
+	if p.iChannel == 1 {
+		sDir = TraceEvent
+	}
+	p.r.mux.Lock()
+	defer p.r.mux.Unlock()
+	rec, err := p.r.next(sDir, p.iChannel)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(rec.Msg), nil
+}
+
+func (p *replayTransport) WriteMsg(b []byte) error {
+
+	p.r.mux.Lock()
+	defer p.r.mux.Unlock()
+	if p.iChannel == 1 {
+		// Answers of the program are checked, if they are in place, but never wait
+		if p.r.iPos < len(p.r.aRec) && p.r.aRec[p.r.iPos].Dir == TraceAnswer {
+			if rec := p.r.aRec[p.r.iPos]; rec.Msg != string(b) {
+				logOr(p.r.pLog).Warn("replay: an answer differs", "msg", string(b), "recorded", rec.Msg)
+			}
+			p.r.iPos++
+			p.r.cond.Broadcast()
+		}
+		return nil
+	}
+	rec, err := p.r.next(TraceOut, p.iChannel)
+	if err != nil {
+		return err
+	}
+	if rec.Msg != string(b) {
+		logOr(p.r.pLog).Warn("replay: a message differs", "msg", string(b), "recorded", rec.Msg)
+	}
+	return nil
+}
+
+func (p *replayTransport) setLogger(pLog *slog.Logger) {
+	p.r.mux.Lock()
+	p.r.pLog = pLog
+	p.r.mux.Unlock()
+}
+
+func (p *replayTransport) Close() error {
+	p.r.mux.Lock()
+	p.r.bClosed = true
+	p.r.cond.Broadcast()
+	p.r.mux.Unlock()
+	return nil
+}
@@ -0,0 +1,295 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Connection types, used in Options.Type
+const (
+	TypeTCP  = 1 // tcp/ip, ports Port and Port+1
+	TypeFile = 2 // regular files <Dir>/<FileRoot>.gs1 and .gs2
+	TypeUnix = 3 // Unix domain sockets <Dir>/<FileRoot>.gs1 and .gs2, needs FeatUnix
+	TypePipe = 4 // pipes of a GuiServer process, started by the session, needs FeatPipe
+)
+
+// TypeUnix and TypePipe need a GuiServer build, which accepts "-t3" and "-t4" command line
+// options; as no GuiServer release is known to support them, a program must declare
+// a version of such a build: WithFeature(FeatPipe, "1.5"), for example.
+// Connecting fails with ErrUnsupported, if the feature isn't declared or the GuiServer is older.
+
+// Transport is one of two channels between a session and a GuiServer.
+// The first channel carries messages of a program and GuiServer replies to them,
+// the second - messages of a GuiServer (events) and replies of a program.
+// A message is passed to WriteMsg and returned by ReadMsg without the protocol framing
+// (a leading '+' and a trailing newline), so a transport may use its own framing.
+type Transport interface {
+	// Dial establishes the connection, trying it until it succeeds or ctx is done.
+	Dial(ctx context.Context) error
+	// ReadMsg waits for a next message and returns it.
+	ReadMsg() ([]byte, error)
+	// WriteMsg sends a message.
+	WriteMsg(b []byte) error
+	// Close closes the connection, ReadMsg, waiting for a message, returns an error.
+	Close() error
+}
+
+// ConnEx is a Transport for tcp/ip (TypeTCP) and Unix domain socket (TypeUnix) connections.
+type ConnEx struct {
+	iType     int8
+	iPort     int
+	sIp       string
+	sFileName string
+	tReply    time.Duration
+	iMaxSize  int
+	conn      net.Conn
+	rd        *msgReader
+	pLog      *slog.Logger
+}
+
+// NewTCPTransport returns a Transport, which connects to a GuiServer on sIp:iPort.
+// If tReply isn't 0, ReadMsg fails, when a message doesn't come during tReply.
+// If a message is longer, than iMaxSize bytes, ReadMsg skips it and returns ErrMessageTooLarge;
+// 0 means DefMaxMessageSize.
+func NewTCPTransport(sIp string, iPort int, tReply time.Duration, iMaxSize int) *ConnEx {
+	return &ConnEx{iType: TypeTCP, sIp: sIp, iPort: iPort, tReply: tReply, iMaxSize: iMaxSize}
+}
+
+// NewUnixTransport returns a Transport, which connects to a GuiServer via a Unix domain
+// socket sPath, tReply and iMaxSize are the same as for NewTCPTransport.
+func NewUnixTransport(sPath string, tReply time.Duration, iMaxSize int) *ConnEx {
+	return &ConnEx{iType: TypeUnix, sFileName: sPath, tReply: tReply, iMaxSize: iMaxSize}
+}
+
+// Dial tries to establish the connection until it succeeds or ctx is done.
+func (p *ConnEx) Dial(ctx context.Context) error {
+
+	var err error
+
+	for {
+		var d net.Dialer
+		if p.iType == TypeTCP {
+			p.conn, err = d.DialContext(ctx, "tcp4", net.JoinHostPort(p.sIp, strconv.Itoa(p.iPort)))
+		} else if p.iType == TypeUnix {
+			p.conn, err = d.DialContext(ctx, "unix", p.sFileName)
+		} else {
+			return fmt.Errorf("external: wrong connection type %d", p.iType)
+		}
+		if err == nil {
+			p.rd = newMsgReader(p.conn, p.iMaxSize)
+			return nil
+		}
+		if sleepCtx(ctx, 250*time.Millisecond) != nil {
+			break
+		}
+	}
+	if p.iType == TypeTCP {
+		logOr(p.pLog).Error("can't connect", "address", p.sIp, "port", p.iPort, "err", err)
+	} else {
+		logOr(p.pLog).Error("can't connect", "socket", p.sFileName, "err", err)
+	}
+	return err
+}
+
+func (p *ConnEx) setLogger(pLog *slog.Logger) {
+	p.pLog = pLog
+}
+
+// Close closes the connection.
+func (p *ConnEx) Close() error {
+
+	if p.conn != nil {
+		return p.conn.Close()
+	}
+	return nil
+}
+
+// ReadMsg waits for a next message and returns it.
+func (p *ConnEx) ReadMsg() ([]byte, error) {
+
+	var tDeadline time.Time
+	if p.tReply > 0 {
+		tDeadline = time.Now().Add(p.tReply)
+	}
+	p.conn.SetReadDeadline(tDeadline)
+	return p.rd.ReadMsg()
+}
+
+// WriteMsg sends a message.
+func (p *ConnEx) WriteMsg(b []byte) error {
+
+	_, err := p.conn.Write(frame(b))
+	return err
+}
+
+// pipeTransport is a Transport via pipes of a GuiServer process (TypePipe).
+// The first channel uses stdin and stdout of the process, the second one -
+// file descriptors 3 (messages of a GuiServer) and 4 (replies).
+type pipeTransport struct {
+	r, w   *os.File
+	tReply time.Duration
+	rd     *msgReader
+}
+
+// newPipes creates pipes for a GuiServer process, the returned files must be passed
+// to it as stdin, stdout, fd 3 and fd 4 and closed after the process is started.
+func newPipes(tReply time.Duration, iMaxSize int) (pOut, pIn *pipeTransport, aChild []*os.File, err error) {
+
+	var aFiles []*os.File
+	for i := 0; i < 4; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, f := range aFiles {
+				f.Close()
+			}
+			return nil, nil, nil, err
+		}
+		aFiles = append(aFiles, r, w)
+	}
+	// aFiles: stdin r,w; stdout r,w; fd3 r,w; fd4 r,w
+	pOut = &pipeTransport{r: aFiles[2], w: aFiles[1], tReply: tReply, rd: newMsgReader(aFiles[2], iMaxSize)}
+	pIn = &pipeTransport{r: aFiles[4], w: aFiles[7], rd: newMsgReader(aFiles[4], iMaxSize)}
+	return pOut, pIn, []*os.File{aFiles[0], aFiles[3], aFiles[5], aFiles[6]}, nil
+}
+
+// Dial does nothing, the pipes are connected, when a GuiServer process is started.
+func (p *pipeTransport) Dial(ctx context.Context) error {
+	return nil
+}
+
+func (p *pipeTransport) ReadMsg() ([]byte, error) {
+
+	if p.tReply > 0 {
+		p.r.SetReadDeadline(time.Now().Add(p.tReply))
+	}
+	b, err := p.rd.ReadMsg()
+	if errors.Is(err, io.EOF) {
+		err = net.ErrClosed
+	}
+	return b, err
+}
+
+func (p *pipeTransport) WriteMsg(b []byte) error {
+	_, err := p.w.Write(frame(b))
+	return err
+}
+
+func (p *pipeTransport) Close() error {
+	p.w.Close()
+	return p.r.Close()
+}
+
+// newTransports creates transports for both channels: by Options.Transport, if it is set,
+// or according to Options.Type.
+func (s *Session) newTransports(opts Options, sFileName string) (Transport, Transport, error) {
+
+	pOut, pIn, err := s.createTransports(opts, sFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, p := range []Transport{pOut, pIn} {
+		if pl, bOk := p.(loggerSetter); bOk {
+			pl.setLogger(s.logger())
+		}
+	}
+	return pOut, pIn, nil
+}
+
+func (s *Session) createTransports(opts Options, sFileName string) (Transport, Transport, error) {
+
+	if opts.Transport != nil {
+		return opts.Transport(0), opts.Transport(1), nil
+	}
+	switch opts.Type {
+	case TypeTCP:
+		return NewTCPTransport(opts.Address, opts.Port, opts.ReplyTimeout, opts.MaxMessageSize),
+			NewTCPTransport(opts.Address, opts.Port+1, 0, opts.MaxMessageSize), nil
+	case TypeFile:
+		return NewFileTransport(sFileName+".gs1", opts.ReplyTimeout, opts.MaxMessageSize),
+			NewFileTransport(sFileName+".gs2", 0, opts.MaxMessageSize), nil
+	case TypeUnix:
+		return NewUnixTransport(sFileName+".gs1", opts.ReplyTimeout, opts.MaxMessageSize),
+			NewUnixTransport(sFileName+".gs2", 0, opts.MaxMessageSize), nil
+	case TypePipe:
+		s.mux.Lock()
+		pProc := s.pProc
+		s.mux.Unlock()
+		if pProc == nil || pProc.pOut == nil {
+			return nil, nil, errors.New("external: pipes need a GuiServer, started by the session")
+		}
+		return pProc.pOut, pProc.pIn, nil
+	}
+	return nil, nil, fmt.Errorf("external: wrong connection type %d", opts.Type)
+}
+
+// DefMaxMessageSize is a default limit of a message size, see Options.MaxMessageSize.
+const DefMaxMessageSize = 64 << 20
+
+// msgReader splits a stream to messages, each message is ended by a newline.
+type msgReader struct {
+	rd       *bufio.Reader
+	iMaxSize int
+}
+
+func newMsgReader(r io.Reader, iMaxSize int) *msgReader {
+	if iMaxSize <= 0 {
+		iMaxSize = DefMaxMessageSize
+	}
+	return &msgReader{rd: bufio.NewReaderSize(r, 4096), iMaxSize: iMaxSize}
+}
+
+// ReadMsg returns a next message without the framing. A message, which is longer,
+// than iMaxSize, is read to the end and skipped, ErrMessageTooLarge is returned.
+func (m *msgReader) ReadMsg() ([]byte, error) {
+
+	var buf []byte
+	iLen := 0
+	for {
+		b, err := m.rd.ReadSlice('\n')
+		iLen += len(b)
+		// '+' and "\r\n" aren't counted
+		if iLen <= m.iMaxSize+3 {
+			buf = append(buf, b...)
+		} else {
+			buf = nil
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+	b := unframe(buf)
+	if buf == nil || len(b) > m.iMaxSize {
+		return nil, fmt.Errorf("%w: %d bytes, the limit is %d", ErrMessageTooLarge, iLen, m.iMaxSize)
+	}
+	return b, nil
+}
+
+// frame adds the protocol framing to a message b.
+func frame(b []byte) []byte {
+	buf := make([]byte, 0, len(b)+2)
+	buf = append(buf, '+')
+	buf = append(buf, b...)
+	return append(buf, '\n')
+}
+
+// unframe removes the protocol framing from a message b.
+func unframe(b []byte) []byte {
+	b = bytes.TrimRight(b, "\r\n")
+	return bytes.TrimPrefix(b, []byte("+"))
+}
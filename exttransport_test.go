@@ -0,0 +1,64 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	egui "github.com/alkresin/external"
+)
+
+func TestMsgReader(t *testing.T) {
+	sLong := strings.Repeat("x", 10000)
+	for _, tc := range []struct {
+		sName    string
+		sStream  string
+		iMaxSize int
+		bOneByte bool     // the stream is read by one byte, so messages come partially
+		aWant    []string // messages or "!" for ErrMessageTooLarge
+	}{
+		{"one", "+[\"a\"]\n", 0, false, []string{`["a"]`}},
+		{"coalesced", "+1\n+2\r\n+3\n", 0, false, []string{"1", "2", "3"}},
+		{"partial", "+first\n+second\r\n", 0, true, []string{"first", "second"}},
+		{"no plus", "abc\n", 0, false, []string{"abc"}},
+		{"empty", "+\n\n", 0, false, []string{"", ""}},
+		{"longer than a buffer", "+" + sLong + "\n+2\n", 0, false, []string{sLong, "2"}},
+		{"longer than a buffer, partial", "+" + sLong + "\n", 0, true, []string{sLong}},
+		{"at the limit", "+12345\r\n", 5, false, []string{"12345"}},
+		{"oversize", "+123456\n+1\n", 5, false, []string{"!", "1"}},
+		{"oversize, longer than a buffer", "+" + sLong + "\n+ok\n", 100, false, []string{"!", "ok"}},
+		{"oversize, partial", "+" + sLong + "\n+ok\n", 100, true, []string{"!", "ok"}},
+	} {
+		t.Run(tc.sName, func(t *testing.T) {
+			var r io.Reader = strings.NewReader(tc.sStream)
+			if tc.bOneByte {
+				r = iotest.OneByteReader(r)
+			}
+			rd := egui.NewMsgReader(r, tc.iMaxSize)
+			for i, sWant := range tc.aWant {
+				b, err := rd.ReadMsg()
+				if sWant == "!" {
+					if !errors.Is(err, egui.ErrMessageTooLarge) {
+						t.Errorf("message %d: %v, want ErrMessageTooLarge", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("message %d: %v", i, err)
+				}
+				if string(b) != sWant {
+					t.Errorf("message %d: %.20q (%d bytes), want %.20q (%d bytes)", i, b, len(b), sWant, len(sWant))
+				}
+			}
+			if b, err := rd.ReadMsg(); err != io.EOF {
+				t.Errorf("after messages: %q, %v, want EOF", b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"fmt"
+)
+
+// Typed widgets embed a *Widget and have methods, specific for their types.
+// They are created by methods of a parent window or widget, AddButton, AddBrowse, etc.,
+// which set a widget type themselves:
+//
+//	pBrw, err := pWnd.AddBrowse(&egui.Widget{X: 10, Y: 10, W: 300, H: 200})
+//	pBrw.SetArray(&arr)
+//
+// A typed widget for a *Widget, which is created otherwise, is returned by AsLabel, AsBrowse, etc.
+
+// Label is a "label" widget.
+type Label struct{ *Widget }
+
+// Button is a "button" widget.
+type Button struct{ *Widget }
+
+// Edit is an "edit" widget.
+type Edit struct{ *Widget }
+
+// Check is a "check" widget.
+type Check struct{ *Widget }
+
+// Combo is a "combo" widget.
+type Combo struct{ *Widget }
+
+// Bitmap is a "bitmap" widget.
+type Bitmap struct{ *Widget }
+
+// OwnButton is an "ownbtn" widget.
+type OwnButton struct{ *Widget }
+
+// RadioGroup is a "radiogr" widget, which starts a group of radio buttons.
+type RadioGroup struct{ *Widget }
+
+// Browse is a "browse" widget.
+type Browse struct{ *Widget }
+
+// Tree is a "tree" widget.
+type Tree struct{ *Widget }
+
+// Tab is a "tab" widget.
+type Tab struct{ *Widget }
+
+// Progress is a "progress" widget.
+type Progress struct{ *Widget }
+
+// CodeEdit is a "cedit" widget, a code editor.
+type CodeEdit struct{ *Widget }
+
+// AddLabel adds a new "label" widget to o, see Add.
+func (o *Widget) AddLabel(pWidg *Widget) (*Label, error) {
+	return addAs(o, pWidg, "label", func(p *Widget) *Label { return &Label{p} })
+}
+
+// AddButton adds a new "button" widget to o, see Add.
+func (o *Widget) AddButton(pWidg *Widget) (*Button, error) {
+	return addAs(o, pWidg, "button", func(p *Widget) *Button { return &Button{p} })
+}
+
+// AddEdit adds a new "edit" widget to o, see Add.
+func (o *Widget) AddEdit(pWidg *Widget) (*Edit, error) {
+	return addAs(o, pWidg, "edit", func(p *Widget) *Edit { return &Edit{p} })
+}
+
+// AddCheck adds a new "check" widget to o, see Add.
+func (o *Widget) AddCheck(pWidg *Widget) (*Check, error) {
+	return addAs(o, pWidg, "check", func(p *Widget) *Check { return &Check{p} })
+}
+
+// AddCombo adds a new "combo" widget to o, see Add.
+func (o *Widget) AddCombo(pWidg *Widget) (*Combo, error) {
+	return addAs(o, pWidg, "combo", func(p *Widget) *Combo { return &Combo{p} })
+}
+
+// AddBitmap adds a new "bitmap" widget to o, see Add.
+func (o *Widget) AddBitmap(pWidg *Widget) (*Bitmap, error) {
+	return addAs(o, pWidg, "bitmap", func(p *Widget) *Bitmap { return &Bitmap{p} })
+}
+
+// AddOwnButton adds a new "ownbtn" widget to o, see Add.
+func (o *Widget) AddOwnButton(pWidg *Widget) (*OwnButton, error) {
+	return addAs(o, pWidg, "ownbtn", func(p *Widget) *OwnButton { return &OwnButton{p} })
+}
+
+// AddRadioGroup adds a new "radiogr" widget to o, see Add. Radio buttons, added after it,
+// belong to the group, until End is called.
+func (o *Widget) AddRadioGroup(pWidg *Widget) (*RadioGroup, error) {
+	return addAs(o, pWidg, "radiogr", func(p *Widget) *RadioGroup { return &RadioGroup{p} })
+}
+
+// AddBrowse adds a new "browse" widget to o, see Add.
+func (o *Widget) AddBrowse(pWidg *Widget) (*Browse, error) {
+	return addAs(o, pWidg, "browse", func(p *Widget) *Browse { return &Browse{p} })
+}
+
+// AddTree adds a new "tree" widget to o, see Add.
+func (o *Widget) AddTree(pWidg *Widget) (*Tree, error) {
+	return addAs(o, pWidg, "tree", func(p *Widget) *Tree { return &Tree{p} })
+}
+
+// AddTab adds a new "tab" widget to o, see Add.
+func (o *Widget) AddTab(pWidg *Widget) (*Tab, error) {
+	return addAs(o, pWidg, "tab", func(p *Widget) *Tab { return &Tab{p} })
+}
+
+// AddProgress adds a new "progress" widget to o, see Add.
+func (o *Widget) AddProgress(pWidg *Widget) (*Progress, error) {
+	return addAs(o, pWidg, "progress", func(p *Widget) *Progress { return &Progress{p} })
+}
+
+// AddCodeEdit adds a new "cedit" widget to o, see Add.
+func (o *Widget) AddCodeEdit(pWidg *Widget) (*CodeEdit, error) {
+	return addAs(o, pWidg, "cedit", func(p *Widget) *CodeEdit { return &CodeEdit{p} })
+}
+
+// addAs adds a widget pWidg of a type sType to o and returns it as a typed widget, made by mk.
+func addAs[T any](o *Widget, pWidg *Widget, sType string, mk func(*Widget) T) (T, error) {
+	var t T
+	if pWidg.Type != "" && pWidg.Type != sType {
+		return t, fmt.Errorf("%w: \"%s\" is added as \"%s\"", ErrWrongType, pWidg.Type, sType)
+	}
+	pWidg.Type = sType
+	p, err := o.Add(pWidg)
+	if p != nil {
+		t = mk(p)
+	}
+	return t, err
+}
+
+// AsLabel returns o as a *Label, if it is a "label" widget.
+func AsLabel(o *Widget) (*Label, bool) {
+	if o == nil || o.Type != "label" {
+		return nil, false
+	}
+	return &Label{o}, true
+}
+
+// AsButton returns o as a *Button, if it is a "button" widget.
+func AsButton(o *Widget) (*Button, bool) {
+	if o == nil || o.Type != "button" {
+		return nil, false
+	}
+	return &Button{o}, true
+}
+
+// AsEdit returns o as a *Edit, if it is an "edit" widget.
+func AsEdit(o *Widget) (*Edit, bool) {
+	if o == nil || o.Type != "edit" {
+		return nil, false
+	}
+	return &Edit{o}, true
+}
+
+// AsCheck returns o as a *Check, if it is a "check" widget.
+func AsCheck(o *Widget) (*Check, bool) {
+	if o == nil || o.Type != "check" {
+		return nil, false
+	}
+	return &Check{o}, true
+}
+
+// AsCombo returns o as a *Combo, if it is a "combo" widget.
+func AsCombo(o *Widget) (*Combo, bool) {
+	if o == nil || o.Type != "combo" {
+		return nil, false
+	}
+	return &Combo{o}, true
+}
+
+// AsBitmap returns o as a *Bitmap, if it is a "bitmap" widget.
+func AsBitmap(o *Widget) (*Bitmap, bool) {
+	if o == nil || o.Type != "bitmap" {
+		return nil, false
+	}
+	return &Bitmap{o}, true
+}
+
+// AsOwnButton returns o as a *OwnButton, if it is an "ownbtn" widget.
+func AsOwnButton(o *Widget) (*OwnButton, bool) {
+	if o == nil || o.Type != "ownbtn" {
+		return nil, false
+	}
+	return &OwnButton{o}, true
+}
+
+// AsRadioGroup returns o as a *RadioGroup, if it is a "radiogr" widget.
+func AsRadioGroup(o *Widget) (*RadioGroup, bool) {
+	if o == nil || o.Type != "radiogr" {
+		return nil, false
+	}
+	return &RadioGroup{o}, true
+}
+
+// AsBrowse returns o as a *Browse, if it is a "browse" widget.
+func AsBrowse(o *Widget) (*Browse, bool) {
+	if o == nil || o.Type != "browse" {
+		return nil, false
+	}
+	return &Browse{o}, true
+}
+
+// AsTree returns o as a *Tree, if it is a "tree" widget.
+func AsTree(o *Widget) (*Tree, bool) {
+	if o == nil || o.Type != "tree" {
+		return nil, false
+	}
+	return &Tree{o}, true
+}
+
+// AsTab returns o as a *Tab, if it is a "tab" widget.
+func AsTab(o *Widget) (*Tab, bool) {
+	if o == nil || o.Type != "tab" {
+		return nil, false
+	}
+	return &Tab{o}, true
+}
+
+// AsProgress returns o as a *Progress, if it is a "progress" widget.
+func AsProgress(o *Widget) (*Progress, bool) {
+	if o == nil || o.Type != "progress" {
+		return nil, false
+	}
+	return &Progress{o}, true
+}
+
+// AsCodeEdit returns o as a *CodeEdit, if it is a "cedit" widget.
+func AsCodeEdit(o *Widget) (*CodeEdit, bool) {
+	if o == nil || o.Type != "cedit" {
+		return nil, false
+	}
+	return &CodeEdit{o}, true
+}
+
+// End completes a group of radio buttons, iSel is a number of a selected one.
+func (p *RadioGroup) End(iSel int) error {
+	return RadioEnd(p.Widget, iSel)
+}
+
+// SetArray sets a two-dimensional slice to be represented in a browse.
+func (p *Browse) SetArray(arr *[][]string) error {
+	return BrwSetArray(p.Widget, arr)
+}
+
+// Array returns a two-dimensional slice from a browse, see BrwGetArray.
+// An error is returned for a browse with a source.
+func (p *Browse) Array() ([][]string, error) {
+	return brwGetArray(p.Widget)
+}
+
+// SetColumn defines options for a column with number ic, see BrwSetColumn.
+func (p *Browse) SetColumn(ic int, sHead string, iAlignHead int, iAlignData int, bEditable bool, iLength int) error {
+	return BrwSetColumn(p.Widget, ic, sHead, iAlignHead, iAlignData, bEditable, iLength)
+}
+
+// SetColumnEx sets other options for a column with number ic, see BrwSetColumnEx.
+func (p *Browse) SetColumnEx(ic int, sParam string, xParam interface{}) error {
+	return BrwSetColumnEx(p.Widget, ic, sParam, xParam)
+}
+
+// DelColumn deletes a column with number ic.
+func (p *Browse) DelColumn(ic int) error {
+	return BrwDelColumn(p.Widget, ic)
+}
+
+// InsertNode inserts a node to a tree, see InsertNode.
+func (p *Tree) InsertNode(sNodeName string, sNodeNew string, sTitle string,
+	sNodeNext string, aImages []string, fu func([]string) string, sCode string) error {
+	return InsertNode(p.Widget, sNodeName, sNodeNew, sTitle, sNodeNext, aImages, fu, sCode)
+}
+
+// SelectNode selects a node sNodeName.
+func (p *Tree) SelectNode(sNodeName string) error {
+	return SelectNode(p.Widget, sNodeName)
+}
+
+// Page starts a new page of a tab; widgets, added after it, belong to the page until PageEnd.
+func (p *Tab) Page(sCaption string) error {
+	return TabPage(p.Widget, sCaption)
+}
+
+// PageEnd completes a description of a page.
+func (p *Tab) PageEnd() error {
+	return TabPageEnd(p.Widget)
+}
+
+// Step does a next step of a progress bar.
+func (p *Progress) Step() error {
+	return PBarStep(p.Widget)
+}
+
+// Set sets a progress bar position.
+func (p *Progress) Set(iPos int) error {
+	return PBarSet(p.Widget, iPos)
+}
+
+// SetHighliter sets or unsets (if pHili == nil) a highliter, created by CreateHighliter.
+func (p *CodeEdit) SetHighliter(pHili *Highlight) error {
+	return SetHighliter(p.Widget, pHili)
+}
+
+// SetHiliOpt defines highlighting options for a group iGroup: a font, text color and background color.
+func (p *CodeEdit) SetHiliOpt(iGroup int, pFont *Font, tColor int32, bColor int32) error {
+	return SetHiliOpt(p.Widget, iGroup, pFont, tColor, bColor)
+}
+
+// checkType returns ErrWrongType, if a type of a widget o isn't one of aTypes.
+// Widgets without a type (created by forms, for example) are accepted.
+func checkType(o *Widget, aTypes ...string) error {
+	if o.Type == "" {
+		return nil
+	}
+	for _, s := range aTypes {
+		if o.Type == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is \"%s\"", ErrWrongType, o.Name, o.Type)
+}
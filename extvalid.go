@@ -0,0 +1,249 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Validator checks values of widgets of a dialog or a window by rules, attached to them:
+//
+//	v := egui.NewValidator(pDlg)
+//	v.Add(pName, "Name", egui.Required(), egui.Length(2, 40))
+//	v.Add(pAge, "Age", egui.Range(18, 120))
+//	v.Add(pMail, "E-mail", egui.Match(`^[^@ ]+@[^@ ]+$`))
+//	v.OnOK(pBtnOk, func() { egui.Collect(pDlg, &person) })
+//
+// Invalid fields are highlighted by InvalidTColor and InvalidBColor, an error is shown
+// as a tooltip; when a field becomes valid, its colors and tooltip are restored.
+type Validator struct {
+	InvalidTColor int32  // A text color of invalid fields
+	InvalidBColor int32  // A background color of invalid fields
+	Title         string // A title of a message with errors, see OnOK
+	KeepFocus     bool   // An invalid field keeps a focus, see ValidateOnFocusLoss
+	pWnd          *Widget
+	aFields       []*validField
+}
+
+// A Rule checks a value of a field, it returns nil, if the value is valid.
+// Any func(string) error may be used as a custom rule.
+type Rule func(string) error
+
+// FieldError describes an invalid field.
+type FieldError struct {
+	Widget *Widget
+	Label  string // A field label, as it is passed to Validator.Add
+	Err    error  // An error, returned by a rule
+}
+
+func (e FieldError) Error() string {
+	return e.Label + ": " + e.Err.Error()
+}
+
+func (e FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by Validator.Validate, if some fields are invalid.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	aLines := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		aLines[i] = f.Error()
+	}
+	return strings.Join(aLines, "\n")
+}
+
+// ErrRequired is returned by Required for an empty field.
+var ErrRequired = errors.New("a value is required")
+
+// validField is a widget with rules, attached to it.
+type validField struct {
+	pWidg    *Widget
+	sLabel   string
+	aRules   []Rule
+	sTooltip string // an own tooltip of a widget to restore
+	sError   string // an error, shown for the widget now, empty, if it is valid
+}
+
+// NewValidator creates a Validator for widgets of a window or a dialog pWnd.
+func NewValidator(pWnd *Widget) *Validator {
+	return &Validator{InvalidBColor: 0xccccff, Title: "Validation", pWnd: pWnd}
+}
+
+// Add attaches rules aRules to a widget pWidg, sLabel is used in error messages,
+// a widget name is used, if it is empty. Rules are checked in order, until one of them fails.
+func (v *Validator) Add(pWidg *Widget, sLabel string, aRules ...Rule) *Validator {
+	if sLabel == "" {
+		sLabel = pWidg.Name
+	}
+	v.aFields = append(v.aFields, &validField{pWidg: pWidg, sLabel: sLabel, aRules: aRules, sTooltip: pWidg.Tooltip})
+	return v
+}
+
+// Validate reads values of all fields with one request to the GuiServer and checks them,
+// invalid fields are highlighted. It returns a *ValidationError, if some fields are invalid,
+// or an error of the GuiServer connection.
+func (v *Validator) Validate() error {
+	aNames := make([]string, len(v.aFields))
+	for i, f := range v.aFields {
+		aNames[i] = windowName(f.pWidg)
+	}
+	arr, err := v.pWnd.session().GetValues(v.pWnd.window(), aNames)
+	if err != nil {
+		return err
+	}
+	var aErrs []FieldError
+	for i, f := range v.aFields {
+		var sValue string
+		if i < len(arr) {
+			sValue = arr[i]
+		}
+		if ferr := v.check(f, sValue); ferr != nil {
+			aErrs = append(aErrs, *ferr)
+		}
+	}
+	if aErrs != nil {
+		return &ValidationError{Fields: aErrs}
+	}
+	return nil
+}
+
+// ValidateOnFocusLoss sets "onlostfocus" callbacks for all fields, so that each of them
+// is checked and highlighted, when it loses a focus. If KeepFocus is set, an invalid field
+// keeps a focus, otherwise the focus moves on.
+func (v *Validator) ValidateOnFocusLoss() error {
+	for _, f := range v.aFields {
+		f := f
+		err := f.pWidg.OnFunc("onlostfocus", func(Event) string {
+			sValue, err := f.pWidg.Text()
+			if err != nil {
+				return "t"
+			}
+			if v.check(f, sValue) != nil && v.KeepFocus {
+				return "f"
+			}
+			return "t"
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnOK sets an "onclick" handler of a button pBtn, which validates fields and,
+// if they are valid, calls fu (it may be nil) and closes the window. Otherwise errors
+// are shown by MsgStop and the window stays opened; if values can't be read,
+// the error is written to the log and shown by MsgStop, too.
+func (v *Validator) OnOK(pBtn *Widget, fu func()) error {
+	return pBtn.OnClick(func(ClickEvent) {
+		s := v.pWnd.session()
+		err := v.Validate()
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			s.MsgStop(verr.Error(), v.Title, nil, "", "")
+			return
+		}
+		if err != nil {
+			s.logger().Error("can't validate", "window", v.pWnd.Name, "err", err)
+			s.MsgStop(err.Error(), v.Title, nil, "", "")
+			return
+		}
+		if fu != nil {
+			fu()
+		}
+		v.pWnd.Close()
+	})
+}
+
+// check checks a value sValue of a field f and highlights it or restores its view.
+func (v *Validator) check(f *validField, sValue string) *FieldError {
+	for _, fu := range f.aRules {
+		if err := fu(sValue); err != nil {
+			if f.sError == "" {
+				f.pWidg.SetColor(v.InvalidTColor, v.InvalidBColor)
+			}
+			if f.sError != err.Error() {
+				f.sError = err.Error()
+				f.pWidg.SetTooltip(f.sError)
+			}
+			return &FieldError{Widget: f.pWidg, Label: f.sLabel, Err: err}
+		}
+	}
+	if f.sError != "" {
+		f.sError = ""
+		bColor := f.pWidg.BColor
+		if bColor == 0 {
+			bColor = -1 // a default background
+		}
+		f.pWidg.SetColor(f.pWidg.TColor, bColor)
+		f.pWidg.SetTooltip(f.sTooltip)
+	}
+	return nil
+}
+
+// Required returns a rule, which fails for an empty (or containing spaces only) value.
+func Required() Rule {
+	return func(s string) error {
+		if strings.TrimSpace(s) == "" {
+			return ErrRequired
+		}
+		return nil
+	}
+}
+
+// Match returns a rule, which fails, if a non-empty value doesn't match a regular expression
+// sPattern. It panics, if sPattern can't be compiled, as regexp.MustCompile does.
+func Match(sPattern string) Rule {
+	re := regexp.MustCompile(sPattern)
+	return func(s string) error {
+		if s != "" && !re.MatchString(s) {
+			return fmt.Errorf("a value doesn't match %s", sPattern)
+		}
+		return nil
+	}
+}
+
+// Range returns a rule, which fails, if a non-empty value isn't a number from fMin to fMax.
+func Range(fMin, fMax float64) Rule {
+	return func(s string) error {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		if f < fMin || f > fMax {
+			return fmt.Errorf("a value must be from %g to %g", fMin, fMax)
+		}
+		return nil
+	}
+}
+
+// Length returns a rule, which fails, if a length of a value in characters is less than iMin
+// or greater than iMax; iMax == 0 means no upper limit.
+func Length(iMin, iMax int) Rule {
+	return func(s string) error {
+		n := utf8.RuneCountInString(s)
+		if n < iMin {
+			return fmt.Errorf("at least %d characters are needed", iMin)
+		}
+		if iMax > 0 && n > iMax {
+			return fmt.Errorf("not more than %d characters are allowed", iMax)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+func TestRules(t *testing.T) {
+	for _, tc := range []struct {
+		sName  string
+		rule   egui.Rule
+		sValue string
+		bValid bool
+	}{
+		{"required", egui.Required(), "a", true},
+		{"required, empty", egui.Required(), "", false},
+		{"required, spaces", egui.Required(), "  ", false},
+		{"match", egui.Match(`^\d+$`), "123", true},
+		{"match, wrong", egui.Match(`^\d+$`), "12a", false},
+		{"match, empty", egui.Match(`^\d+$`), "", true},
+		{"range", egui.Range(18, 120), "18", true},
+		{"range, spaces", egui.Range(18, 120), " 120 ", true},
+		{"range, less", egui.Range(18, 120), "17.9", false},
+		{"range, greater", egui.Range(18, 120), "121", false},
+		{"range, not a number", egui.Range(18, 120), "abc", false},
+		{"range, empty", egui.Range(18, 120), "", true},
+		{"length", egui.Length(2, 4), "абв", true},
+		{"length, short", egui.Length(2, 4), "a", false},
+		{"length, long", egui.Length(2, 4), "abcde", false},
+		{"length, no limit", egui.Length(1, 0), strings.Repeat("a", 1000), true},
+	} {
+		if err := tc.rule(tc.sValue); (err == nil) != tc.bValid {
+			t.Errorf("%s: %q: %v", tc.sName, tc.sValue, err)
+		}
+	}
+}
+
+// params returns properties sProps of a widget sName of a fake GuiServer srv as json.
+func params(t *testing.T, srv *externaltest.Server, sName string, sProps ...string) string {
+	t.Helper()
+	o, bOk := srv.Widget(sName)
+	if !bOk {
+		t.Fatalf("no %s", sName)
+	}
+	aRes := make([]interface{}, len(sProps))
+	for i, sProp := range sProps {
+		aRes[i] = o.Params[sProp]
+	}
+	b, _ := json.Marshal(aRes)
+	return string(b)
+}
+
+func TestValidator(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pWnd := mainWindow(t, s)
+	pPanel, _ := pWnd.Add(&egui.Widget{Type: "panel", Name: "pnl"})
+	pName, _ := pWnd.Add(&egui.Widget{Type: "edit", Name: "edtName", Tooltip: "your name"})
+	pAge, _ := pPanel.Add(&egui.Widget{Type: "edit", Name: "edtAge", TColor: 0xff, BColor: 0xeeeeee})
+
+	v := egui.NewValidator(pWnd)
+	v.Add(pName, "Name", egui.Required()).Add(pAge, "", egui.Required(), egui.Range(18, 120))
+
+	for _, tc := range []struct {
+		sName, sAge string
+		aInvalid    []string // labels of invalid fields
+		sNameView   string   // color and tooltip of fields after validation
+		sAgeView    string
+	}{
+		{"", "", []string{"Name", "edtAge"},
+			`[[0,13421823],"a value is required"]`, `[[0,13421823],"a value is required"]`},
+		{"Bob", "17", []string{"edtAge"},
+			`[[0,-1],"your name"]`, `[[0,13421823],"a value must be from 18 to 120"]`},
+		{"Bob", "x", []string{"edtAge"},
+			`[[0,-1],"your name"]`, `[[0,13421823],"\"x\" is not a number"]`},
+		{"Bob", "30", nil,
+			`[[0,-1],"your name"]`, `[[255,15658734],""]`},
+	} {
+		pName.SetText(tc.sName)
+		pAge.SetText(tc.sAge)
+		err := v.Validate()
+		var aLabels []string
+		var verr *egui.ValidationError
+		if errors.As(err, &verr) {
+			for _, f := range verr.Fields {
+				aLabels = append(aLabels, f.Label)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(aLabels, ",") != strings.Join(tc.aInvalid, ",") {
+			t.Errorf("%q, %q: invalid %v, want %v", tc.sName, tc.sAge, aLabels, tc.aInvalid)
+		}
+		if s := params(t, srv, "main.edtName", "color", "tooltip"); s != tc.sNameView {
+			t.Errorf("%q, %q: name %s, want %s", tc.sName, tc.sAge, s, tc.sNameView)
+		}
+		if s := params(t, srv, "main.pnl.edtAge", "color", "tooltip"); s != tc.sAgeView {
+			t.Errorf("%q, %q: age %s, want %s", tc.sName, tc.sAge, s, tc.sAgeView)
+		}
+	}
+}
+
+func TestValidatorEvents(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pWnd := mainWindow(t, s)
+	pName, _ := pWnd.Add(&egui.Widget{Type: "edit", Name: "edtName"})
+	pBtn, _ := pWnd.Add(&egui.Widget{Type: "button", Name: "btnOk"})
+
+	v := egui.NewValidator(pWnd)
+	v.KeepFocus = true
+	v.Add(pName, "Name", egui.Required())
+	var bOk atomic.Bool
+	if err := v.ValidateOnFocusLoss(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.OnOK(pBtn, func() { bOk.Store(true) }); err != nil {
+		t.Fatal(err)
+	}
+	activate(t, srv, pWnd)
+
+	o, _ := srv.Widget("main.edtName")
+	m := reHandler.FindStringSubmatch(o.Callbacks["onlostfocus"])
+	if m == nil {
+		t.Fatalf("onlostfocus: %q", o.Callbacks["onlostfocus"])
+	}
+	for _, tc := range []struct {
+		sText string
+		bKeep bool
+		sRes  string
+	}{
+		{"", true, "f"},
+		{"", false, "t"},
+		{"Bob", true, "t"},
+	} {
+		pName.SetText(tc.sText)
+		v.KeepFocus = tc.bKeep
+		if sRes, err := srv.RunFunc(m[1], "main.edtName"); err != nil || sRes != tc.sRes {
+			t.Errorf("%q, KeepFocus %v: %q, %v, want %q", tc.sText, tc.bKeep, sRes, err, tc.sRes)
+		}
+	}
+
+	pName.SetText("")
+	if err := srv.Fire("main.btnOk", "onclick"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Wait(func() bool { return strings.Contains(lastMsg(srv), `"mstop"`) }, time.Second) || bOk.Load() {
+		t.Errorf("invalid fields: %s, fu is called %v", lastMsg(srv), bOk.Load())
+	}
+	pName.SetText("Bob")
+	if err := srv.Fire("main.btnOk", "onclick"); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Wait(func() bool { return lastMsg(srv) == `["close","main"]` }, time.Second) || !bOk.Load() {
+		t.Errorf("valid fields: %s, fu is called %v", lastMsg(srv), bOk.Load())
+	}
+}
@@ -6,9 +6,11 @@ package external
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
-	"strings"
+
+	"github.com/alkresin/external/internal/protocol"
 )
 
 // A set of constants of the anchor values
@@ -98,6 +100,7 @@ type Printer struct {
 	BPreview   bool
 	IFormType  int
 	BLandscape bool
+	sess       *Session
 }
 
 // The Widget structure prepares data to create a new widget or window
@@ -116,28 +119,62 @@ type Widget struct {
 	Tooltip  string
 	Anchor   int32
 	Font     *Font
-	AProps   map[string]string
+	AProps   map[string]string // Properties, see mWidgs; Props is preferable
+	Props    WidgetProps       // Typed properties: ComboProps, SplitterProps, etc.
 	aWidgets []*Widget
+	// mHandlers keeps names of functions, registered for callbacks of the widget, see Session.handler.
+	mHandlers map[string]string
+	pLayout   Layout
+	pSource   *browseSource
+	sess      *Session
+	rlog      *replayLog
 }
 
-var mfu map[string]func([]string) string
-var pMainWindow *Widget
-var aDialogs []*Widget
-var aFonts []*Font
-var aStyles []*Style
-var iIdCount int32
-
-// PLastWindow is a pointer to a last used window structure (*Widget)
+// PLastWindow is a pointer to a last used window structure (*Widget) of the default session,
+// see Session.LastWindow for other sessions.
 var PLastWindow *Widget
 
-// PLastWidget is a pointer to a last used widget structure (*Widget)
+// PLastWidget is a pointer to a last used widget structure (*Widget) of the default session,
+// see Session.LastWidget for other sessions.
 var PLastWidget *Widget
 
-// PLastPrinter is a pointer to a last used printer structure (*Printer)
+// PLastPrinter is a pointer to a last used printer structure (*Printer) of the default session,
+// see Session.LastPrinter for other sessions.
 var PLastPrinter *Printer
 
+// LastWindow returns a last created window of the session.
+func (s *Session) LastWindow() *Widget {
+	return s.lastWnd()
+}
+
+// LastWidget returns a last created widget of the session.
+func (s *Session) LastWidget() *Widget {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.pLastWidget
+}
+
+// LastPrinter returns a last initialized printer of the session.
+func (s *Session) LastPrinter() *Printer {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.pLastPrinter
+}
+
+// mirrorLast copies last used elements of the default session to PLastWindow,
+// PLastWidget and PLastPrinter, other sessions don't change them. s.mux must be locked.
+func (s *Session) mirrorLast() {
+	muxDefSess.Lock()
+	bDef := s == pDefSess
+	muxDefSess.Unlock()
+	if bDef {
+		PLastWindow, PLastWidget, PLastPrinter = s.pLastWnd, s.pLastWidget, s.pLastPrinter
+	}
+}
+
 // Var mWidgs includes all possible widgets types with
-// its properties, which may be installed, using AProps member of a Widget structure.
+// its properties, which may be installed, using AProps member of a Widget structure;
+// typed properties (see WidgetProps) are preferable.
 var mWidgs = map[string]map[string]string{
 	"main":      {"Icon": "C"},
 	"dialog":    {"Icon": "C", "NoExitOnEsc": "L", "NoCloseAble": "L"},
@@ -166,6 +203,16 @@ var mWidgs = map[string]map[string]string{
 	"link":      {"Link": "C", "ClrVisited": "N", "ClrLink": "N", "ClrOver": "N"},
 	"monthcal":  {"NoToday": "L", "NoTodayCirc": "L", "WeekNumb": "L"}}
 
+// session returns the Session, the widget belongs to.
+func (o *Widget) session() *Session {
+	for p := o; p != nil; p = p.Parent {
+		if p.sess != nil {
+			return p.sess
+		}
+	}
+	return DefaultSession()
+}
+
 func widgFullName(pWidg *Widget) string {
 	sName := pWidg.Name
 
@@ -177,9 +224,11 @@ func widgFullName(pWidg *Widget) string {
 }
 
 // Returns a pointer to a Font structure with a Name member equal to sName argument.
-func GetFont(sName string) *Font {
-	if aFonts != nil {
-		for _, o := range aFonts {
+func (s *Session) GetFont(sName string) *Font {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.aFonts != nil {
+		for _, o := range s.aFonts {
 			if o.Name == sName {
 				return o
 			}
@@ -189,9 +238,11 @@ func GetFont(sName string) *Font {
 }
 
 // Returns a pointer to a Style structure with a Name member equal to sName argument.
-func GetStyle(sName string) *Style {
-	if aStyles != nil {
-		for _, o := range aStyles {
+func (s *Session) GetStyle(sName string) *Style {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.aStyles != nil {
+		for _, o := range s.aStyles {
 			if o.Name == sName {
 				return o
 			}
@@ -201,97 +252,101 @@ func GetStyle(sName string) *Style {
 }
 
 // Wnd returns a pointer to a Widget structure (a window or a dialog) with a Name member equal to sName argument.
-func Wnd(sName string) *Widget {
-	if sName == "main" {
-		return pMainWindow
-	} else if aDialogs != nil {
-		for _, o := range aDialogs {
-			if o.Name == sName {
-				return o
-			}
-		}
+func (s *Session) Wnd(sName string) *Widget {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.wnd(sName)
+}
+
+func (s *Session) wnd(sName string) *Widget {
+	if o := s.mWidg[sName]; o != nil && o.Parent == nil {
+		return o
 	}
 	return nil
 }
 
 // Widg returns a pointer to a Widget structure (a widget) with a Name member corresponding to sName argument.
 // The sName must be compound name, containing a names of all parent widgets and windows, defined by dots.
-func Widg(sName string) *Widget {
-	npos := strings.Index(sName, ".")
-	if npos == -1 {
-		return Wnd(sName)
-	}
-	sWnd := sName[:npos]
-	sName = sName[npos+1:]
-	if oWnd := Wnd(sWnd); oWnd != nil {
-		for npos = strings.Index(sName, "."); npos > -1; npos = strings.Index(sName, ".") {
-			sWnd := sName[:npos]
-			sName = sName[npos+1:]
-			for _, o := range oWnd.aWidgets {
-				if o.Name == sWnd {
-					oWnd = o
-					break
-				}
-			}
-			if oWnd == nil {
-				return nil
-			}
-		}
-		for _, o := range oWnd.aWidgets {
-			if o.Name == sName {
-				return o
-			}
-		}
-	}
-	return nil
+// See also Find and FindAll.
+func (s *Session) Widg(sName string) *Widget {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.mWidg[sName]
 }
 
-func setprops(pWidg *Widget, mwidg map[string]string) string {
+// setprops returns properties of a widget pWidg: common ones, AProps and Props.
+// An error is returned, if AProps contain a property, which isn't listed in mwidg,
+// or a value of a wrong type, or Props don't belong to the widget type;
+// such properties are skipped, other ones are returned anyway.
+func setprops(pWidg *Widget, mwidg map[string]string) (protocol.Props, error) {
 
-	sPar := ""
+	var errRes error
+
+	props := protocol.Props{}
 	if pWidg.Winstyle != 0 {
-		sPar += fmt.Sprintf(",\"Winstyle\": %d", pWidg.Winstyle)
+		props["Winstyle"] = pWidg.Winstyle
 	}
 	if pWidg.TColor != 0 {
-		sPar += fmt.Sprintf(",\"TColor\": %d", pWidg.TColor)
+		props["TColor"] = pWidg.TColor
 	}
 	if pWidg.BColor != 0 {
-		sPar += fmt.Sprintf(",\"BColor\": %d", pWidg.BColor)
+		props["BColor"] = pWidg.BColor
 	}
 	if pWidg.Tooltip != "" {
-		sPar += fmt.Sprintf(",\"Tooltip\": \"%s\"", pWidg.Tooltip)
+		props["Tooltip"] = pWidg.Tooltip
 	}
 	if pWidg.Font != nil {
-		sPar += fmt.Sprintf(",\"Font\": \"%s\"", pWidg.Font.Name)
+		props["Font"] = pWidg.Font.Name
 	}
 	if pWidg.Anchor != 0 {
 		if pWidg.Anchor == A_TOPLEFT {
 			pWidg.Anchor = 0
 		}
-		sPar += fmt.Sprintf(",\"Anchor\": %d", pWidg.Anchor)
-	}
-	if pWidg.AProps != nil {
-		for name, val := range pWidg.AProps {
-			cType, bOk := mwidg[name]
-			if bOk {
-				if cType == "C" {
-					sPar += fmt.Sprintf(",\"%s\": \"%s\"", name, val)
-				} else if cType == "L" {
-					sPar += fmt.Sprintf(",\"%s\": \"%s\"", name, val)
-				} else if cType == "N" {
-					sPar += fmt.Sprintf(",\"%s\": %s", name, val)
-				} else if cType == "AC" {
-					sPar += fmt.Sprintf(",\"%s\": %s", name, val)
-				}
-			} else {
-				WriteLog(fmt.Sprintf("Error! \"%s\" does not defined for \"%s\"\r\n", name, pWidg.Type))
-			}
+		props["Anchor"] = pWidg.Anchor
+	}
+	for name, val := range pWidg.AProps {
+		cType, bOk := mwidg[name]
+		if !bOk {
+			errRes = fmt.Errorf("%w: \"%s\" is not defined for \"%s\"", ErrWrongProps, name, pWidg.Type)
+		} else if cType == "C" || cType == "L" {
+			props[name] = val
+		} else if !validProp(cType, val) {
+			errRes = fmt.Errorf("%w: \"%s\" value %q is wrong for \"%s\"", ErrWrongProps, name, val, pWidg.Type)
+		} else {
+			props[name] = json.RawMessage(val)
 		}
 	}
-	if sPar != "" {
-		sPar = ",{" + sPar[1:] + "}"
+	if pWidg.Props != nil {
+		tProps, err := pWidg.Props.props(pWidg.Type)
+		if err != nil {
+			errRes = err
+		}
+		for name, val := range tProps {
+			props[name] = val
+		}
 	}
-	return sPar
+	return props, errRes
+}
+
+// validProp reports, whether val is a json number for a property type cType "N"
+// or a json array for "AC".
+func validProp(cType string, val string) bool {
+	var x interface{}
+	if json.Unmarshal([]byte(val), &x) != nil {
+		return false
+	}
+	switch x.(type) {
+	case float64:
+		return cType == "N"
+	case []interface{}:
+		return cType == "AC"
+	}
+	return false
+}
+
+// widgRect returns a position, a size and a title of a window or a widget pWidg.
+func widgRect(pWidg *Widget) protocol.Rect {
+	return protocol.Rect{X: pWidg.X, Y: pWidg.Y, W: pWidg.W, H: pWidg.H, Title: pWidg.Title}
 }
 
 // ToString converts function arguments to a json string
@@ -314,425 +369,400 @@ func ToString(xParam ...interface{}) string {
 
 // OpenMainForm reads a main window description from a xml file, prepared by HwGUI's Designer,
 // initialises and activates this window with all its widgets
-func OpenMainForm(sForm string) bool {
-	var bres bool
-	b, err := json.Marshal(sForm)
-	if err != nil {
-		WriteLog(fmt.Sprintln(err))
-		return false
+func (s *Session) OpenMainForm(sForm string) error {
+	if err := s.sendout(protocol.NewCmd("openformmain", sForm)); err != nil {
+		return err
 	}
-	bres = sendout("[\"openformmain\"," + string(b) + "]")
-	Wait()
-	return bres
+	s.Wait()
+	return nil
 }
 
 // OpenForm reads a dialog window description from a xml file, prepared by HwGUI's Designer,
 // initialises and activates this dialog with all its widgets
-func OpenForm(sForm string) bool {
-	var bres bool
-	b, err := json.Marshal(sForm)
-	if err != nil {
-		WriteLog(fmt.Sprintln(err))
-		return false
-	}
-	bres = sendout("[\"openform\"," + string(b) + "]")
-	return bres
+func (s *Session) OpenForm(sForm string) error {
+	return s.sendout(protocol.NewCmd("openform", sForm))
 }
 
 // OpenReport reads a report description from a xml file, prepared by HwGUI's Designer
 // and prints this report
-func OpenReport(sForm string) bool {
-	var b bool
-	b = sendout("[\"openreport\",\"" + sForm + "\"]")
-	return b
+func (s *Session) OpenReport(sForm string) error {
+	return s.sendout(protocol.NewCmd("openreport", sForm))
 }
 
 // CreateFont creates a font with parameters, defined in a structure, pointed by pFont argument.
-func CreateFont(pFont *Font) *Font {
+func (s *Session) CreateFont(pFont *Font) (*Font, error) {
 
-	pFont.new()
-	sParams := fmt.Sprintf("[\"crfont\",\"%s\",\"%s\",%d,%t,%t,%t,%t,%d]", pFont.Name, pFont.Family, pFont.Height,
-		pFont.Bold, pFont.Italic, pFont.Underline, pFont.Strikeout, pFont.Charset)
-	sendout(sParams)
-	return pFont
+	s.addFont(pFont)
+	sParams := protocol.CrFont{Name: pFont.Name, Family: pFont.Family, Height: pFont.Height,
+		Bold: pFont.Bold, Italic: pFont.Italic, Underline: pFont.Underline, Strikeout: pFont.Strikeout,
+		Charset: pFont.Charset}
+	s.record(nil, "font."+pFont.Name, sParams)
+	return pFont, s.sendout(sParams)
 }
 
 // CreateStyle creates a style with parameters, defined in a structure, pointed by pStyle argument.
-func CreateStyle(pStyle *Style) *Style {
+func (s *Session) CreateStyle(pStyle *Style) (*Style, error) {
 
 	if pStyle.Name == "" {
-		pStyle.Name = fmt.Sprintf("s%d", iIdCount)
-		iIdCount++
+		pStyle.Name = s.newName("s")
 	}
-	if aStyles == nil {
-		aStyles = make([]*Style, 0, 16)
+	s.mux.Lock()
+	if s.aStyles == nil {
+		s.aStyles = make([]*Style, 0, 16)
 	}
-	aStyles = append(aStyles, pStyle)
-	b1, _ := json.Marshal(pStyle.Colors)
-	b2, _ := json.Marshal(pStyle.Corners)
-	sParams := fmt.Sprintf("[\"crstyle\",\"%s\",%s,%d,%s,%d,%d,\"%s\"]", pStyle.Name,
-		string(b1), pStyle.Orient, string(b2),
-		pStyle.BorderW, pStyle.BorderClr, pStyle.Bitmap)
-	sendout(sParams)
-	return pStyle
+	s.aStyles = append(s.aStyles, pStyle)
+	s.mux.Unlock()
+	sParams := protocol.CrStyle{Name: pStyle.Name, Colors: pStyle.Colors, Orient: pStyle.Orient,
+		Corners: pStyle.Corners, BorderW: pStyle.BorderW, BorderClr: pStyle.BorderClr, Bitmap: pStyle.Bitmap}
+	s.record(nil, "style."+pStyle.Name, sParams)
+	return pStyle, s.sendout(sParams)
 }
 
 // CreateHighliter creates a highlight rules for a code editor ("cedit" widget)
-func CreateHighliter(sName string, sCommands string, sFuncs string,
-	sSingleLineComm string, sMultiLineComm string, bCase bool) *Highlight {
+func (s *Session) CreateHighliter(sName string, sCommands string, sFuncs string,
+	sSingleLineComm string, sMultiLineComm string, bCase bool) (*Highlight, error) {
 
-	sParams := fmt.Sprintf("[\"highl\",\"%s\",\"%s\",\"%s\",\"%s\",\"%s\",%t]", sName,
-		sCommands, sFuncs, sSingleLineComm, sMultiLineComm, bCase)
-	sendout(sParams)
-	return &(Highlight{Name: sName})
+	sParams := protocol.NewCmd("highl", sName, sCommands, sFuncs, sSingleLineComm, sMultiLineComm, bCase)
+	s.record(nil, "highl."+sName, sParams)
+	return &(Highlight{Name: sName}), s.sendout(sParams)
 }
 
 // SetHighliter sets or unsets (if p == nil) a given Highliter to a "cedit" widget.
-func SetHighliter(pEdit *Widget, p *Highlight) {
+func SetHighliter(pEdit *Widget, p *Highlight) error {
+	if err := checkType(pEdit, "cedit"); err != nil {
+		return err
+	}
 	var sHiliName string
 	if p == nil {
 		sHiliName = ""
 	} else {
 		sHiliName = p.Name
 	}
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"hili\",\"%s\"]",
-		widgFullName(pEdit), sHiliName)
-	sendout(sParams)
+	sParams := protocol.Set{Name: widgFullName(pEdit), Prop: "hili", Value: sHiliName}
+	pEdit.session().record(pEdit, widgFullName(pEdit)+".hili", sParams)
+	return pEdit.session().sendout(sParams)
 }
 
 // SetHili defines highlighting options for a code editor ("cedit" widget): a font, text color and background color
-func SetHiliOpt(pEdit *Widget, iGroup int, pFont *Font, tColor int32, bColor int32) {
+func SetHiliOpt(pEdit *Widget, iGroup int, pFont *Font, tColor int32, bColor int32) error {
+	if err := checkType(pEdit, "cedit"); err != nil {
+		return err
+	}
 	var sFontName string
 	if pFont == nil {
 		sFontName = ""
 	} else {
 		sFontName = pFont.Name
 	}
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"hiliopt\",[%d,\"%s\",%d,%d]]",
-		widgFullName(pEdit), iGroup, sFontName, tColor, bColor)
-	sendout(sParams)
+	sParams := protocol.Set{Name: widgFullName(pEdit), Prop: "hiliopt",
+		Value: []interface{}{iGroup, sFontName, tColor, bColor}}
+	pEdit.session().record(pEdit, fmt.Sprintf("%s.hiliopt.%d", widgFullName(pEdit), iGroup), sParams)
+	return pEdit.session().sendout(sParams)
 }
 
 // InitPrinter initializes a printer, the name of a printer is passed in SPrinter member of
 // a pPrinter structure. If it is an empty string, the default printer will be used, if it is
 // defined as "...", printer setup dialog will be opened.
-func InitPrinter(pPrinter *Printer, sFunc string, fu func([]string) string, sMark string) *Printer {
+func (s *Session) InitPrinter(pPrinter *Printer, sFunc string, fu func([]string) string, sMark string) (*Printer, error) {
 
 	if pPrinter.Name == "" {
-		pPrinter.Name = fmt.Sprintf("p%d", iIdCount)
-		iIdCount++
+		pPrinter.Name = s.newName("p")
 	}
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sMark = ""
-	}
-	sParams := fmt.Sprintf("[\"prninit\",\"%s\",[\"%s\",%t,%d,%t],\"%s\",\"%s\"]", pPrinter.Name,
-		pPrinter.SPrinter, pPrinter.BPreview, pPrinter.IFormType, pPrinter.BLandscape, sFunc, sMark)
-	sendout(sParams)
-	PLastPrinter = pPrinter
-	return pPrinter
+	sFunc, sMark = s.dialogFunc(fu, sFunc, sMark)
+	sParams := protocol.NewCmd("prninit", pPrinter.Name,
+		[]interface{}{pPrinter.SPrinter, pPrinter.BPreview, pPrinter.IFormType, pPrinter.BLandscape}, sFunc, sMark)
+	pPrinter.sess = s
+	s.mux.Lock()
+	s.pLastPrinter = pPrinter
+	s.mirrorLast()
+	s.mux.Unlock()
+	return pPrinter, s.sendout(sParams)
 }
 
 // AddFont method adds a font, described in Font structure, to the printer.
 func (p *Printer) AddFont(pFont *Font) *Font {
-	pFont.new()
-	sParams := fmt.Sprintf("[\"print\",\"fontadd\",\"%s\",[\"%s\",\"%s\",%d,%t,%t,%t,%d]]", p.Name,
-		pFont.Name, pFont.Family, pFont.Height,
-		pFont.Bold, pFont.Italic, pFont.Underline, pFont.Charset)
-	sendout(sParams)
+	p.sess.addFont(pFont)
+	sParams := protocol.Print{Kind: "fontadd", Printer: p.Name, Args: []interface{}{pFont.Name, pFont.Family,
+		pFont.Height, pFont.Bold, pFont.Italic, pFont.Underline, pFont.Charset}}
+	if err := p.sess.sendout(sParams); err != nil {
+		p.sess.logger().Error("can't add a font", "printer", p.Name, "err", err)
+	}
 	return pFont
 }
 
 // SetFont method sets a font, previously added with AddFont, as current while printing
-func (p *Printer) SetFont(pFont *Font) {
-	sParams := fmt.Sprintf("[\"print\",\"fontset\",\"%s\",[\"%s\"]]", p.Name, pFont.Name)
-	sendout(sParams)
+func (p *Printer) SetFont(pFont *Font) error {
+	sParams := protocol.Print{Kind: "fontset", Printer: p.Name, Args: []interface{}{pFont.Name}}
+	return p.sess.sendout(sParams)
 }
 
 // Say method prints s text string sText in a rectangle with iTop, iLeft, iRight, iBottom
 // coordinates, iOpt defines an alignment.
-func (p *Printer) Say(iTop, iLeft, iRight, iBottom int32, sText string, iOpt int32) {
+func (p *Printer) Say(iTop, iLeft, iRight, iBottom int32, sText string, iOpt int32) error {
 
-	sParams := fmt.Sprintf("[\"print\",\"text\",\"%s\",[\"%s\",%d,%d,%d,%d,%d]]",
-		p.Name, sText, iTop, iLeft, iRight, iBottom, iOpt)
-	sendout(sParams)
+	sParams := protocol.Print{Kind: "text", Printer: p.Name,
+		Args: []interface{}{sText, iTop, iLeft, iRight, iBottom, iOpt}}
+	return p.sess.sendout(sParams)
 }
 
 // Line methods prints a line from iTop, iLeft to iRight, iBottom
-func (p *Printer) Line(iTop, iLeft, iRight, iBottom int32) {
+func (p *Printer) Line(iTop, iLeft, iRight, iBottom int32) error {
 
-	sParams := fmt.Sprintf("[\"print\",\"line\",\"%s\",[%d,%d,%d,%d]]", p.Name, iTop, iLeft, iRight, iBottom)
-	sendout(sParams)
+	sParams := protocol.Print{Kind: "line", Printer: p.Name, Args: []interface{}{iTop, iLeft, iRight, iBottom}}
+	return p.sess.sendout(sParams)
 }
 
 // Box method prints a rectangle with iTop, iLeft, iRight, iBottom coordinates
-func (p *Printer) Box(iTop, iLeft, iRight, iBottom int32) {
+func (p *Printer) Box(iTop, iLeft, iRight, iBottom int32) error {
 
-	sParams := fmt.Sprintf("[\"print\",\"box\",\"%s\",[%d,%d,%d,%d]]", p.Name, iTop, iLeft, iRight, iBottom)
-	sendout(sParams)
+	sParams := protocol.Print{Kind: "box", Printer: p.Name, Args: []interface{}{iTop, iLeft, iRight, iBottom}}
+	return p.sess.sendout(sParams)
 }
 
 // StartPage method begins a new page printed
-func (p *Printer) StartPage() {
+func (p *Printer) StartPage() error {
 
-	sParams := fmt.Sprintf("[\"print\",\"startpage\",\"%s\",[]]", p.Name)
-	sendout(sParams)
+	sParams := protocol.Print{Kind: "startpage", Printer: p.Name}
+	return p.sess.sendout(sParams)
 }
 
 // StartPage method ends a page printed
-func (p *Printer) EndPage() {
+func (p *Printer) EndPage() error {
 
-	sParams := fmt.Sprintf("[\"print\",\"endpage\",\"%s\",[]]", p.Name)
-	sendout(sParams)
+	sParams := protocol.Print{Kind: "endpage", Printer: p.Name}
+	return p.sess.sendout(sParams)
 }
 
 // End method closes a printer
-func (p *Printer) End() {
+func (p *Printer) End() error {
 
-	sParams := fmt.Sprintf("[\"print\",\"end\",\"%s\",[]]", p.Name)
-	sendout(sParams)
+	sParams := protocol.Print{Kind: "end", Printer: p.Name}
+	return p.sess.sendout(sParams)
 }
 
 // Initialises a main window with parameters, defined in a structure, pointed by pWnd argument.
 // To show this window on a screen it is necessary to use Activate() method.
-func InitMainWindow(pWnd *Widget) bool {
-	pMainWindow = pWnd
-	PLastWindow = pWnd
+// Wrong properties are skipped, the window is created and ErrWrongProps is returned.
+func (s *Session) InitMainWindow(pWnd *Widget) error {
 	pWnd.Type = "main"
 	pWnd.Name = "main"
-	sPar2 := setprops(pWnd, mWidgs["main"])
-	sParams := fmt.Sprintf("[\"crmainwnd\",[%d,%d,%d,%d,\"%s\"]%s]", pWnd.X, pWnd.Y, pWnd.W,
-		pWnd.H, pWnd.Title, sPar2)
-	return sendout(sParams)
+	props, errProps := setprops(pWnd, mWidgs["main"])
+	s.mux.Lock()
+	if s.pMainWindow != nil {
+		s.forget(s.pMainWindow)
+	}
+	s.pMainWindow = pWnd
+	s.register(pWnd)
+	s.pLastWnd = pWnd
+	pWnd.rlog = nil
+	s.mirrorLast()
+	s.mux.Unlock()
+	pWnd.sess = s
+	sParams := protocol.CrMainWnd{Rect: widgRect(pWnd), Props: props}
+	s.record(pWnd, "", sParams)
+	if err := s.sendout(sParams); err != nil {
+		return err
+	}
+	return errProps
 }
 
 // Initialises a dialog window with parameters, defined in a structure, pointed by pWnd argument.
 // To show this window on a screen it is necessary to use Activate() method.
-func InitDialog(pWnd *Widget) bool {
-	PLastWindow = pWnd
+// Wrong properties are skipped, the window is created and ErrWrongProps is returned.
+func (s *Session) InitDialog(pWnd *Widget) error {
+	pWnd.sess = s
 	pWnd.Type = "dialog"
 	if pWnd.Name == "" {
-		pWnd.Name = fmt.Sprintf("w%d", iIdCount)
-		iIdCount++
+		pWnd.Name = s.newName("w")
 	}
-	if aDialogs == nil {
-		aDialogs = make([]*Widget, 0, 8)
+	props, errProps := setprops(pWnd, mWidgs["dialog"])
+	s.mux.Lock()
+	s.pLastWnd = pWnd
+	s.mirrorLast()
+	pWnd.rlog = nil
+	if s.aDialogs == nil {
+		s.aDialogs = make([]*Widget, 0, 8)
 	}
-	aDialogs = append(aDialogs, pWnd)
-
-	sPar2 := setprops(pWnd, mWidgs["dialog"])
-	sParams := fmt.Sprintf("[\"crdialog\",\"%s\",[%d,%d,%d,%d,\"%s\"]%s]", pWnd.Name, pWnd.X, pWnd.Y, pWnd.W,
-		pWnd.H, pWnd.Title, sPar2)
-	return sendout(sParams)
+	s.aDialogs = append(s.aDialogs, pWnd)
+	s.register(pWnd)
+	s.mux.Unlock()
+
+	sParams := protocol.CrDialog{Name: pWnd.Name, Rect: widgRect(pWnd), Props: props}
+	s.record(pWnd, "", sParams)
+	if err := s.sendout(sParams); err != nil {
+		return err
+	}
+	return errProps
 }
 
 // EvalProc sends a code fragment, written on Harbour to a GuiServer to execute
 // and does not return a result.
-func EvalProc(s string) {
+func (s *Session) EvalProc(sCode string) error {
 
-	b, _ := json.Marshal(s)
-	sendout("[\"evalcode\"," + string(b) + "]")
+	return s.sendout(protocol.NewCmd("evalcode", sCode))
 }
 
 // EvalFunc sends a code fragment, written on Harbour to a GuiServer to execute
 // and returns a result.
-func EvalFunc(s string) []byte {
+func (s *Session) EvalFunc(sCode string) ([]byte, error) {
 
-	b, _ := json.Marshal(s)
-	b = sendoutAndReturn("[\"evalcode\"," + string(b) + ",\"t\"]")
-	if b[0] == byte('+') && b[1] == byte('"') {
-		b = b[2 : len(b)-1]
+	b, err := s.sendoutAndReturn(protocol.NewCmd("evalcode", sCode, "t"))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 1 && b[0] == byte('"') {
+		b = b[1 : len(b)-1]
 	}
-	return b
+	return b, nil
 }
 
 // GetValues returns list of values from widgets of a pWnd window (main or a dialog),
 // listed by names in aNames slice.
 func GetValues(pWnd *Widget, aNames []string) []string {
-	sParams := "[\"getvalues\",\"" + pWnd.Name + "\",["
-	for i, v := range aNames {
-		if i > 0 {
-			sParams += ","
-		}
-		sParams += "\"" + v + "\""
+	arr, _ := pWnd.session().GetValues(pWnd, aNames)
+	return arr
+}
+
+// GetValues returns list of values from widgets of a pWnd window (main or a dialog),
+// listed by names in aNames slice.
+func (s *Session) GetValues(pWnd *Widget, aNames []string) ([]string, error) {
+	if aNames == nil {
+		aNames = []string{}
 	}
-	sParams += "]]"
-	b := sendoutAndReturn(sParams)
-	arr := make([]string, len(aNames))
-	err := json.Unmarshal(b[1:], &arr)
+	b, err := s.sendoutAndReturn(protocol.NewCmd("getvalues", pWnd.Name, aNames))
 	if err != nil {
-		return nil
-	} else {
-		return arr
+		return nil, err
 	}
+	arr := make([]string, len(aNames))
+	if err = unmarshalReply(b, &arr); err != nil {
+		return nil, err
+	}
+	return arr, nil
 }
 
 // GetVersion returns the version string in different verbosity level, depending of i value
 // i == 0  - GuiServer version only ("1.3", for example);
 // i == 1  - GuiServer version with "GuiServer" word;
 // i == 2  - GuiServer, Harbour and HwGUI versions.
-func GetVersion(i int) string {
+func (s *Session) GetVersion(i int) (string, error) {
 
 	var sRes string
-	b := sendoutAndReturn("[\"getver\"," + strconv.Itoa(i) + "]")
-	if b[0] == byte('+') {
-		b = b[1:len(b)]
-	}
-	err := json.Unmarshal(b, &sRes)
+	b, err := s.sendoutAndReturn(protocol.NewCmd("getver", i))
 	if err != nil {
-		return ""
+		return "", err
 	}
-	return sRes
+	if err = unmarshalReply(b, &sRes); err != nil {
+		return "", err
+	}
+	return sRes, nil
 }
 
 // MsgInfo creates a standard nessagebox
 // sTitle - box title, sMessage - text in a box
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func MsgInfo(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) {
+func (s *Session) MsgInfo(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	b, _ := json.Marshal(sMessage)
-	sParams := fmt.Sprintf("[\"common\",\"minfo\",\"%s\",\"%s\",%s,\"%s\"]", sFunc, sName, string(b), sTitle)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "minfo", Func: sFunc, Name: sName, Args: []interface{}{sMessage, sTitle}}
+	return s.sendout(sParams)
 }
 
 // MsgStop creates a standard nessagebox
 // sTitle - box title, sMessage - text in a box
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func MsgStop(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) {
+func (s *Session) MsgStop(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	b, _ := json.Marshal(sMessage)
-	sParams := fmt.Sprintf("[\"common\",\"mstop\",\"%s\",\"%s\",%s,\"%s\"]", sFunc, sName, string(b), sTitle)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "mstop", Func: sFunc, Name: sName, Args: []interface{}{sMessage, sTitle}}
+	return s.sendout(sParams)
 }
 
 // MsgYesNo creates a standard nessagebox
 // sTitle - box title, sMessage - text in a box
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func MsgYesNo(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) {
+func (s *Session) MsgYesNo(sMessage string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	b, _ := json.Marshal(sMessage)
-	sParams := fmt.Sprintf("[\"common\",\"myesno\",\"%s\",\"%s\",%s,\"%s\"]", sFunc, sName, string(b), sTitle)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "myesno", Func: sFunc, Name: sName, Args: []interface{}{sMessage, sTitle}}
+	return s.sendout(sParams)
 }
 
 // MsgGet creates a messagebox, which allows to input a string
 // sTitle - box title, sMessage - text in a box, iStyle - a Winstyle for an "edit" widget (ES_PASSWORD, for example).
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func MsgGet(sMessage string, sTitle string, iStyle int32, fu func([]string) string, sFunc string, sName string) {
+func (s *Session) MsgGet(sMessage string, sTitle string, iStyle int32, fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	b, _ := json.Marshal(sMessage)
-	sParams := fmt.Sprintf("[\"common\",\"mget\",\"%s\",\"%s\",%s,\"%s\",%d]", sFunc, sName, string(b), sTitle, iStyle)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "mget", Func: sFunc, Name: sName, Args: []interface{}{sMessage, sTitle, iStyle}}
+	return s.sendout(sParams)
 }
 
 // Choice creates a dialog with a "browse" inside, which allows to select one of items in
 // a passed slice arr.
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func Choice(arr []string, sTitle string, fu func([]string) string, sFunc string, sName string) {
+func (s *Session) Choice(arr []string, sTitle string, fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	b, _ := json.Marshal(arr)
-	sParams := fmt.Sprintf("[\"common\",\"mchoi\",\"%s\",\"%s\",%s,\"%s\"]", sFunc, sName, string(b), sTitle)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "mchoi", Func: sFunc, Name: sName, Args: []interface{}{arr, sTitle}}
+	return s.sendout(sParams)
 }
 
 // SelectFile creates a standard dialog to select file
 // sPath - initial path;
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func SelectFile(sPath string, fu func([]string) string, sFunc string, sName string) {
+func (s *Session) SelectFile(sPath string, fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	sParams := fmt.Sprintf("[\"common\",\"cfile\",\"%s\",\"%s\",\"%s\"]", sFunc, sName, sPath)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "cfile", Func: sFunc, Name: sName, Args: []interface{}{sPath}}
+	return s.sendout(sParams)
 }
 
 // SelectFolder creates a standard dialog to select folder
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func SelectFolder(fu func([]string) string, sFunc string, sName string) {
+func (s *Session) SelectFolder(fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	sParams := fmt.Sprintf("[\"common\",\"cfold\",\"%s\",\"%s\"]", sFunc, sName)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "cfold", Func: sFunc, Name: sName}
+	return s.sendout(sParams)
 }
 
 // SelectColor creates a standard dialog to select color
 // iColor - base color;
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func SelectColor(iColor int32, fu func([]string) string, sFunc string, sName string) {
+func (s *Session) SelectColor(iColor int32, fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-		sName = ""
-	}
-	sParams := fmt.Sprintf("[\"common\",\"ccolor\",\"%s\",\"%s\",%d]", sFunc, sName, iColor)
-	sendout(sParams)
+	sFunc, sName = s.dialogFunc(fu, sFunc, sName)
+	sParams := protocol.Common{Kind: "ccolor", Func: sFunc, Name: sName, Args: []interface{}{iColor}}
+	return s.sendout(sParams)
 }
 
 // SelectFont creates a standard dialog to select font
-// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier;
+// fu, sFunc - a definition of a callback procedure; fu - function, sFunc - identifier
+// (generated, if it is empty, see OnResult);
 // sName - a parameter, passed to a callback procedure.
-func SelectFont(fu func([]string) string, sFunc string, sName string) {
+func (s *Session) SelectFont(fu func([]string) string, sFunc string, sName string) error {
 
-	if fu != nil && sFunc != "" {
-		RegFunc(sFunc, fu)
-	} else {
-		sFunc = ""
-	}
+	sFunc, _ = s.dialogFunc(fu, sFunc, "")
 	pFont := &(Font{Name: sName})
-	pFont.new()
-	sParams := fmt.Sprintf("[\"common\",\"cfont\",\"%s\",\"%s\"]", sFunc, pFont.Name)
-	sendout(sParams)
+	s.addFont(pFont)
+	sParams := protocol.Common{Kind: "cfont", Func: sFunc, Name: pFont.Name}
+	return s.sendout(sParams)
 }
 
 // InsertNode inserts a node to a tree widget pTree.
@@ -741,233 +771,278 @@ func SelectFont(fu func([]string) string, sFunc string, sName string) {
 // sTitle - a caption of an inserted node;
 // sNodeNext - a name of a node, you want to insert the new before;
 // aImages - path to images for the node ( unselected, selected );
-// fu, sCode - a definition of a callback procedure; fu - function, sCode - identifier or Harbour script.
+// fu, sCode - a definition of a callback procedure; fu - function, sCode - identifier
+// (generated, if it is empty) or, if fu is nil, Harbour script.
 func InsertNode(pTree *Widget, sNodeName string, sNodeNew string, sTitle string,
-	sNodeNext string, aImages []string, fu func([]string) string, sCode string) {
-
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"node\",[\"%s\",\"%s\",\"%s\",\"%s\",",
-		widgFullName(pTree), sNodeName, sNodeNew, sTitle, sNodeNext)
-	if sCode != "" {
-		sName := widgFullName(pTree)
-		if fu != nil {
-			RegFunc(sCode, fu)
-			sCode = "pgo(\"" + sCode + "\",{\"" + sName + "\",\"" + sNodeNew + "\"})"
-		}
-		b, _ := json.Marshal(sCode)
-		sCode = string(b)
-	} else {
-		sCode = "null"
+	sNodeNext string, aImages []string, fu func([]string) string, sCode string) error {
+	if err := checkType(pTree, "tree"); err != nil {
+		return err
 	}
 
-	if aImages == nil {
-		sParams += "null"
-	} else {
-		b, _ := json.Marshal(aImages)
-		sParams += string(b)
+	var xCode, xImages interface{}
+	if fu != nil {
+		sCode = pTree.session().callback(pTree, "node."+sNodeNew, false, fu, sCode)
+		xCode = protocol.Pgo(sCode, widgFullName(pTree), sNodeNew)
+	} else if sCode != "" {
+		xCode = sCode
 	}
-	sParams += "," + sCode + "]]"
+	if aImages != nil {
+		xImages = aImages
+	}
+	sParams := protocol.Set{Name: widgFullName(pTree), Prop: "node",
+		Value: []interface{}{sNodeName, sNodeNew, sTitle, sNodeNext, xImages, xCode}}
 
-	sendout(sParams)
+	pTree.session().record(pTree, "", sParams)
+	return pTree.session().sendout(sParams)
 }
 
-func SelectNode(pTree *Widget, sNodeName string) {
+func SelectNode(pTree *Widget, sNodeName string) error {
+	if err := checkType(pTree, "tree"); err != nil {
+		return err
+	}
 
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"nodesele\",\"%s\"]",
-		widgFullName(pTree), sNodeName)
-	sendout(sParams)
+	sParams := protocol.Set{Name: widgFullName(pTree), Prop: "nodesele", Value: sNodeName}
+	pTree.session().record(pTree, widgFullName(pTree)+".nodesele", sParams)
+	return pTree.session().sendout(sParams)
 }
 
 // PBarStep does a next step for a pPBar progress bar widget
-func PBarStep(pPBar *Widget) {
+func PBarStep(pPBar *Widget) error {
+	if err := checkType(pPBar, "progress"); err != nil {
+		return err
+	}
 
 	var sName = widgFullName(pPBar)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"step\",1]", sName)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "step", Value: 1}
+	return pPBar.session().sendout(sParams)
 }
 
 // PBarSet sets a progress bar position
-func PBarSet(pPBar *Widget, iPos int) {
+func PBarSet(pPBar *Widget, iPos int) error {
+	if err := checkType(pPBar, "progress"); err != nil {
+		return err
+	}
 
 	var sName = widgFullName(pPBar)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"setval\",%d]", sName, iPos)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "setval", Value: iPos}
+	pPBar.session().record(pPBar, sName+".setval", sParams)
+	return pPBar.session().sendout(sParams)
 }
 
 // InitTray forces the main window to be placed in a tray,
 // sIcon - a path to icon file,
 // sMenuName - a name of a context menu,
 // sTooltip - a tooltip for an icon in tray.
-func InitTray(sIcon string, sMenuName string, sTooltip string) {
+func (s *Session) InitTray(sIcon string, sMenuName string, sTooltip string) error {
 
-	sParams := fmt.Sprintf("[\"tray\",\"init\",\"%s\",\"%s\",\"%s\"]", sIcon, sMenuName, sTooltip)
-	sendout(sParams)
+	sParams := protocol.NewCmd("tray", "init", sIcon, sMenuName, sTooltip)
+	s.record(s.mainWnd(), "tray.init", sParams)
+	return s.sendout(sParams)
 }
 
 // ModifyTrayIcon changes a tray icon of a main window,
 // sIcon - a path to icon file.
-func ModifyTrayIcon(sIcon string) {
+func (s *Session) ModifyTrayIcon(sIcon string) error {
 
-	sParams := fmt.Sprintf("[\"tray\",\"icon\",\"%s\"]", sIcon)
-	sendout(sParams)
+	sParams := protocol.NewCmd("tray", "icon", sIcon)
+	s.record(s.mainWnd(), "tray.icon", sParams)
+	return s.sendout(sParams)
 }
 
 // RadioEnd completes a group of radio buttons, started with a "radiogr" widget
-func RadioEnd(p *Widget, iSel int) {
+func RadioEnd(p *Widget, iSel int) error {
+	if err := checkType(p, "radiogr"); err != nil {
+		return err
+	}
 
 	var sName = widgFullName(p)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"radioend\",%d]", sName, iSel)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "radioend", Value: iSel}
+	p.session().record(p, "", sParams)
+	return p.session().sendout(sParams)
 }
 
 // TabPage initialises a new page of a tab widget.
-func TabPage(pTab *Widget, sCaption string) {
+func TabPage(pTab *Widget, sCaption string) error {
+	if err := checkType(pTab, "tab"); err != nil {
+		return err
+	}
 
 	var sName = widgFullName(pTab)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"pagestart\",\"%s\"]", sName, sCaption)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "pagestart", Value: sCaption}
+	pTab.session().record(pTab, "", sParams)
+	return pTab.session().sendout(sParams)
 }
 
 // TabPageEnd completes a description of a page of a tab widget.
-func TabPageEnd(pTab *Widget) {
+func TabPageEnd(pTab *Widget) error {
+	if err := checkType(pTab, "tab"); err != nil {
+		return err
+	}
 
 	var sName = widgFullName(pTab)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"pageend\",1]", sName)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "pageend", Value: 1}
+	pTab.session().record(pTab, "", sParams)
+	return pTab.session().sendout(sParams)
 }
 
 // BrwSetArray sets a two-dimensional slice to be represented in a browse widget p.
-func BrwSetArray(p *Widget, arr *[][]string) {
+func BrwSetArray(p *Widget, arr *[][]string) error {
+	if err := checkType(p, "browse"); err != nil {
+		return err
+	}
 
 	var sName = widgFullName(p)
-	b, _ := json.Marshal(*arr)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"brwarr\",%s]", sName, string(b))
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "brwarr", Value: *arr}
+	p.session().record(p, sName+".brwarr", sParams)
+	return p.session().sendout(sParams)
 }
 
 // BrwGetArray returns a two-dimensional slice from a browse widget p.
+// It returns nil for a browse with a source, set by BrwSetSource.
 func BrwGetArray(p *Widget) [][]string {
+	arr, _ := brwGetArray(p)
+	return arr
+}
+
+func brwGetArray(p *Widget) ([][]string, error) {
+	if err := checkType(p, "browse"); err != nil {
+		return nil, err
+	}
+	if p.pSource != nil {
+		return nil, fmt.Errorf("external: %s has a source, its rows aren't kept in the browse", p.Name)
+	}
 
 	var sName = widgFullName(p)
 	var arr [][]string
 
-	sParams := fmt.Sprintf("[\"get\",\"%s\",\"brwarr\"]", sName)
-	b := sendoutAndReturn(sParams)
-
-	err := json.Unmarshal(b[1:], &arr)
+	sParams := protocol.Get{Name: sName, Prop: "brwarr"}
+	b, err := p.session().sendoutAndReturn(sParams)
 	if err != nil {
-		return nil
-	} else {
-		return arr
+		return nil, err
 	}
+	if err = unmarshalReply(b, &arr); err != nil {
+		return nil, err
+	}
+	return arr, nil
 }
 
 // BrwSetColumn defines options for a column with number ic of a browse widget p.
 // The options are:
-//   sHead string - a column title;
-//   iAlignHead int - the alignment of a column title ( 0 - left, 1 - center, 2 - right );
-//   iAlignData int - the alignment of a column data ( 0 - left, 1 - center, 2 - right );
-//   bEditable bool - is the data in a column editable.
-//   iLength - column width in characters;
+//
+//	sHead string - a column title;
+//	iAlignHead int - the alignment of a column title ( 0 - left, 1 - center, 2 - right );
+//	iAlignData int - the alignment of a column data ( 0 - left, 1 - center, 2 - right );
+//	bEditable bool - is the data in a column editable.
+//	iLength - column width in characters;
 func BrwSetColumn(p *Widget, ic int, sHead string, iAlignHead int, iAlignData int,
-	bEditable bool, iLength int) {
+	bEditable bool, iLength int) error {
+	if err := checkType(p, "browse"); err != nil {
+		return err
+	}
 	var sName = widgFullName(p)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"brwcol\",[%d,\"%s\",%d,%d,%t,%d]]",
-		sName, ic, sHead, iAlignHead, iAlignData, bEditable, iLength)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "brwcol",
+		Value: []interface{}{ic, sHead, iAlignHead, iAlignData, bEditable, iLength}}
+	p.session().record(p, fmt.Sprintf("%s.brwcol.%d", sName, ic), sParams)
+	return p.session().sendout(sParams)
 }
 
 // BrwSetColumnEx sets options for a column with number ic of a browse widget p -
 // those, which can not be set via BrwSetColumn.
 // sParam - option name, xParam - option value
-func BrwSetColumnEx(p *Widget, ic int, sParam string, xParam interface{}) {
+func BrwSetColumnEx(p *Widget, ic int, sParam string, xParam interface{}) error {
+	if err := checkType(p, "browse"); err != nil {
+		return err
+	}
 	var sName = widgFullName(p)
-	var sParValue string
+	var xParValue = xParam
 	var sObj = "d"
 
 	switch v := xParam.(type) {
 	case *Font:
-		sParValue = "\"" + v.Name + "\""
+		xParValue = v.Name
 		sObj = "o"
 	case *Style:
-		sParValue = "\"" + v.Name + "\""
+		xParValue = v.Name
 		sObj = "o"
 	case CodeBlock:
-		b, _ := json.Marshal(xParam)
-		sParValue = string(b)
 		sObj = "b"
-	default:
-		b, _ := json.Marshal(xParam)
-		sParValue = string(b)
 	}
 
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"brwcolx\",[%d,\"%s\",%s,\"%s\"]]",
-		sName, ic, sParam, sParValue, sObj)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "brwcolx", Value: []interface{}{ic, sParam, xParValue, sObj}}
+	p.session().record(p, fmt.Sprintf("%s.brwcolx.%d.%s", sName, ic, sParam), sParams)
+	return p.session().sendout(sParams)
 }
 
 // BrwDelColumn deletes a column with number ic of a browse widget p.
-func BrwDelColumn(p *Widget, ic int) {
+func BrwDelColumn(p *Widget, ic int) error {
+	if err := checkType(p, "browse"); err != nil {
+		return err
+	}
 	var sName = widgFullName(p)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"brwcoldel\",%d]", sName, ic)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "brwcoldel", Value: ic}
+	p.session().record(p, "", sParams)
+	return p.session().sendout(sParams)
 }
 
 // SetVar sets a variable value
-func SetVar(sVarName string, sValue string) {
+func (s *Session) SetVar(sVarName string, sValue string) error {
 
-	sParams := fmt.Sprintf("[\"setvar\",\"%s\",\"%s\"]", sVarName, sValue)
-	sendout(sParams)
+	sParams := protocol.NewCmd("setvar", sVarName, sValue)
+	s.record(nil, "var."+sVarName, sParams)
+	return s.sendout(sParams)
 }
 
 // GetVar gets a variable value
-func GetVar(sVarName string) string {
+func (s *Session) GetVar(sVarName string) (string, error) {
 
 	var sRes string
-	sParams := fmt.Sprintf("[\"getvar\",\"%s\"]", sVarName)
-	b := sendoutAndReturn(sParams)
-	if b[0] == byte('+') {
-		b = b[1:len(b)]
-	}
-	err := json.Unmarshal(b, &sRes)
+	sParams := protocol.NewCmd("getvar", sVarName)
+	b, err := s.sendoutAndReturn(sParams)
 	if err != nil {
-		return ""
+		return "", err
 	}
-
-	return sRes
+	if err = unmarshalReply(b, &sRes); err != nil {
+		return "", err
+	}
+	return sRes, nil
 }
 
 // SetImagePath sets a directory where GuiServer should look for image files.
-func SetImagePath(sValue string) {
+func (s *Session) SetImagePath(sValue string) error {
 
-	sParams := fmt.Sprintf("[\"setparam\",\"bmppath\",\"%s\"]", sValue)
-	sendout(sParams)
+	sParams := protocol.NewCmd("setparam", "bmppath", sValue)
+	s.record(nil, "bmppath", sParams)
+	return s.sendout(sParams)
 }
 
 // SetPath sets a directory where GuiServer should write files
 // and look for files to read.
-func SetPath(sValue string) {
+func (s *Session) SetPath(sValue string) error {
 
-	sParams := fmt.Sprintf("[\"setparam\",\"path\",\"%s\"]", sValue)
-	sendout(sParams)
+	sParams := protocol.NewCmd("setparam", "path", sValue)
+	s.record(nil, "path", sParams)
+	return s.sendout(sParams)
 }
 
 // SetDateFormat sets a date display format,
 // for example, "DD.MM.YYYY"
-func SetDateFormat(sValue string) {
+func (s *Session) SetDateFormat(sValue string) error {
 
-	sParams := fmt.Sprintf("[\"setparam\",\"datef\",\"%s\"]", sValue)
-	sendout(sParams)
+	sParams := protocol.NewCmd("setparam", "datef", sValue)
+	s.record(nil, "datef", sParams)
+	return s.sendout(sParams)
 }
 
-func (p *Font) new() *Font {
+func (s *Session) addFont(p *Font) *Font {
 	if p.Name == "" {
-		p.Name = fmt.Sprintf("f%d", iIdCount)
-		iIdCount++
+		p.Name = s.newName("f")
 	}
-	if aFonts == nil {
-		aFonts = make([]*Font, 0, 16)
+	s.mux.Lock()
+	if s.aFonts == nil {
+		s.aFonts = make([]*Font, 0, 16)
 	}
-	aFonts = append(aFonts, p)
+	s.aFonts = append(s.aFonts, p)
+	s.mux.Unlock()
 	return p
 }
 
@@ -985,43 +1060,106 @@ func (p *Font) FillFont(arr []string) {
 
 // Method Activate shows on the screen a main window or a dialog
 func (o *Widget) Activate() bool {
-	var sParams string
+	return o.ActivateErr() == nil
+}
+
+// Method ActivateErr is the same as Activate, but it reports an error, if any.
+// For a main window it returns, when the application ends.
+func (o *Widget) ActivateErr() error {
+	var sParams protocol.Msg
 	if o.Type == "main" {
-		sParams = fmt.Sprintf("[\"actmainwnd\",[\"f\"]]")
+		sParams = protocol.NewCmd("actmainwnd", []string{"f"})
 	} else if o.Type == "dialog" {
-		sParams = fmt.Sprintf("[\"actdialog\",\"%s\",\"f\",[\"f\"]]", o.Name)
+		sParams = protocol.NewCmd("actdialog", o.Name, "f", []string{"f"})
 	} else {
-		return false
+		return fmt.Errorf("external: %s is not a window", o.Name)
+	}
+	o.session().record(o, "activate", sParams)
+	if err := o.session().sendout(sParams); err != nil {
+		return err
 	}
-	b := sendout("" + sParams)
 	if o.Type == "main" {
-		Wait()
+		o.session().Wait()
 	}
-	return b
+	return nil
 }
 
 // Method Close closes a main window or a dialog
 func (o *Widget) Close() bool {
+	return o.CloseErr() == nil
+}
+
+// Method CloseErr is the same as Close, but it reports an error, if any.
+func (o *Widget) CloseErr() error {
 	if o.Type == "main" || o.Type == "dialog" {
-		sParams := fmt.Sprintf("[\"close\",\"%s\"]", o.Name)
-		b := sendout("" + sParams)
+		sParams := protocol.NewCmd("close", o.Name)
+		err := o.session().sendout(sParams)
 		if o.Type == "dialog" {
 			o.delete()
 		}
-		return b
+		return err
 	}
-	return false
+	return fmt.Errorf("external: %s is not a window", o.Name)
+}
+
+// Destroy removes a widget o with its children on the GuiServer and from widgets of its parent,
+// functions, registered for their callbacks with generated names (see SetCallBackProc),
+// are unregistered. If the GuiServer rejects destroying of widgets or doesn't support it
+// (see FeatDestroy), the widget is hidden. Windows are closed by Close.
+func (o *Widget) Destroy() error {
+	if o.Type == "main" || o.Type == "dialog" {
+		return fmt.Errorf("external: %s is a window, use Close", o.Name)
+	}
+	s := o.session()
+	var err error
+	if s.Supports(FeatDestroy) {
+		sParams := protocol.Set{Name: widgFullName(o), Prop: "destroy", Value: 1}
+		err = s.sendout(sParams)
+		var errRej *ErrServerRejected
+		if errors.As(err, &errRej) {
+			err = o.Hide(true)
+		}
+	} else {
+		err = o.Hide(true)
+	}
+	if err != nil {
+		return err
+	}
+	// The widget isn't restored after reconnecting, a hidden one also.
+	s.unrecord(o)
+	o.delete()
+	return nil
 }
 
+// delete removes a dialog o from dialogs of the session or a widget o from widgets of its parent
+// and unregisters functions of their callbacks.
 func (o *Widget) delete() bool {
+	s := o.session()
+	s.mux.Lock()
+	defer s.mux.Unlock()
 	if o.Type == "dialog" {
-		for i, od := range aDialogs {
+		for i, od := range s.aDialogs {
 			if o.Name == od.Name {
-				aDialogs = append(aDialogs[:i], aDialogs[i+1:]...)
+				s.aDialogs = append(s.aDialogs[:i], s.aDialogs[i+1:]...)
+				s.unregister(o)
+				s.forget(o)
+				return true
+			}
+		}
+	} else if o.Type != "main" && o.Parent != nil {
+		pParent := o.Parent
+		for i, od := range pParent.aWidgets {
+			if od == o {
+				pParent.aWidgets = append(pParent.aWidgets[:i], pParent.aWidgets[i+1:]...)
+				s.unregister(o)
+				s.forget(o)
+				if s.pLastWidget == o {
+					s.pLastWidget = nil
+					s.mirrorLast()
+				}
 				return true
 			}
 		}
-	} else if o.Type != "main" {
 	}
 	return false
 }
@@ -1029,201 +1167,246 @@ func (o *Widget) delete() bool {
 // Method AddWidget adds new child widget
 // o - parent window or widget
 // pWidg - a Widget structure with definition of a new widget
+// Wrong properties are written to the log and skipped, the widget is added anyway.
+// If the widget type is unknown, nil is returned; if the GuiServer doesn't accept
+// the widget, pWidg is returned, but it isn't added to widgets of o. Both are written to the log.
 func (o *Widget) AddWidget(pWidg *Widget) *Widget {
+	p, err := o.add(pWidg, false)
+	if err != nil {
+		o.session().logger().Error("can't add a widget", "widget", pWidg.Name, "type", pWidg.Type, "err", err)
+	}
+	return p
+}
+
+// Method Add is the same as AddWidget, but it reports an error, if any.
+// It returns nil, if the widget type is unknown, its properties are wrong (ErrWrongProps)
+// or the GuiServer doesn't accept it.
+func (o *Widget) Add(pWidg *Widget) (*Widget, error) {
+	return o.add(pWidg, true)
+}
+
+// add adds a widget pWidg to o; if bStrict is false, a widget with wrong properties
+// is added without them and returned with an error.
+func (o *Widget) add(pWidg *Widget, bStrict bool) (*Widget, error) {
+	s := o.session()
 	pWidg.Parent = o
+	pWidg.sess = s
 	mwidg, bOk := mWidgs[pWidg.Type]
 	if !bOk {
-		WriteLog(fmt.Sprintf("Error! \"%s\" does not defined\r\n", pWidg.Type))
-		return nil
+		return nil, fmt.Errorf("external: widget type \"%s\" is not defined", pWidg.Type)
+	}
+	if !s.Supports(pWidg.Type) {
+		return nil, s.unsupported(pWidg.Type)
 	}
 	if pWidg.Name == "" {
-		pWidg.Name = fmt.Sprintf("w%d", iIdCount)
-		iIdCount++
+		pWidg.Name = s.newName("w")
+	}
+	props, errProps := setprops(pWidg, mwidg)
+	if errProps != nil && bStrict {
+		return nil, errProps
 	}
 
-	sPar2 := setprops(pWidg, mwidg)
-	sParams := fmt.Sprintf("[\"addwidg\",\"%s\",\"%s\",[%d,%d,%d,%d,\"%s\"]%s]",
-		pWidg.Type, widgFullName(pWidg), pWidg.X, pWidg.Y, pWidg.W,
-		pWidg.H, pWidg.Title, sPar2)
-	sendout(sParams)
-	PLastWidget = pWidg
+	sParams := protocol.AddWidg{Type: pWidg.Type, Name: widgFullName(pWidg), Rect: widgRect(pWidg),
+		Props: props}
+	s.record(pWidg, "", sParams)
+	if err := s.sendout(sParams); err != nil {
+		// The widget is registered, only when the GuiServer has it.
+		s.unrecord(pWidg)
+		if bStrict {
+			return nil, err
+		}
+		return pWidg, err
+	}
+	s.mux.Lock()
+	s.pLastWidget = pWidg
+	s.mirrorLast()
 	if o.aWidgets == nil {
 		o.aWidgets = make([]*Widget, 0, 16)
 	}
 	o.aWidgets = append(o.aWidgets, pWidg)
-	return pWidg
+	s.register(pWidg)
+	s.mux.Unlock()
+	return pWidg, errProps
 }
 
 // Method SetText sets a text aText to a widget, pointed by o.
-func (o *Widget) SetText(sText string) {
+func (o *Widget) SetText(sText string) error {
 
 	var sName = widgFullName(o)
 	o.Title = sText
-	b, _ := json.Marshal(sText)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"text\",%s]", sName, string(b))
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "text", Value: sText}
+	o.session().record(o, sName+".text", sParams)
+	return o.session().sendout(sParams)
 }
 
 // Method SetImage sets an image widget, pointed by o,
 // sImage - a path to an image
-func (o *Widget) SetImage(sImage string) {
+func (o *Widget) SetImage(sImage string) error {
 
 	var sName = widgFullName(o)
 
-	mwidg, bOk := mWidgs[o.Type]
-	if !bOk {
-		return
-	}
-	_, bOk = mwidg["Image"]
-	if !bOk {
-		return
+	if err := checkType(o, "bitmap", "ownbtn"); err != nil {
+		return err
 	}
 
 	if o.AProps == nil {
 		o.AProps = make(map[string]string)
 	}
 	o.AProps["Image"] = sImage
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"image\",\"%s\"]", sName, sImage)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "image", Value: sImage}
+	o.session().record(o, sName+".image", sParams)
+	return o.session().sendout(sParams)
 }
 
 // Method SetParam sets a property to a widget, pointed by o,
 // sParam - a name of a property,
 // xParam - a value of a property.
-func (o *Widget) SetParam(sParam string, xParam interface{}) {
+func (o *Widget) SetParam(sParam string, xParam interface{}) error {
 
 	var sName = widgFullName(o)
-	var sParValue string
+	var xParValue = xParam
 	var sObj = "d"
 
 	switch v := xParam.(type) {
 	case *Font:
-		sParValue = "\"" + v.Name + "\""
+		xParValue = v.Name
 		sObj = "o"
 	case *Style:
-		sParValue = "\"" + v.Name + "\""
+		xParValue = v.Name
 		sObj = "o"
 	case *Widget:
-		sParValue = "\"" + v.Name + "\""
+		xParValue = v.Name
 		sObj = "o"
 	case *Highlight:
-		sParValue = "\"" + v.Name + "\""
+		xParValue = v.Name
 		sObj = "o"
 	case CodeBlock:
-		b, _ := json.Marshal(xParam)
-		sParValue = string(b)
 		sObj = "b"
-	default:
-		b, _ := json.Marshal(xParam)
-		sParValue = string(b)
 	}
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"xparam\",[\"%s\",%s,\"%s\"]]", sName, sParam, sParValue, sObj)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "xparam", Value: []interface{}{sParam, xParValue, sObj}}
+	o.session().record(o, sName+".xparam."+sParam, sParams)
+	return o.session().sendout(sParams)
 }
 
 // Method GetText gets the text from a widget, pointed by o.
 func (o *Widget) GetText() string {
+	sRes, _ := o.Text()
+	return sRes
+}
+
+// Method Text gets the text from a widget, pointed by o, and reports an error, if any.
+func (o *Widget) Text() (string, error) {
 	var sRes string
 	var sName = widgFullName(o)
 
-	sParams := fmt.Sprintf("[\"get\",\"%s\",\"text\"]", sName)
-	b := sendoutAndReturn(sParams)
-	if b[0] == byte('+') {
-		b = b[1:len(b)]
-	}
-	err := json.Unmarshal(b, &sRes)
+	sParams := protocol.Get{Name: sName, Prop: "text"}
+	b, err := o.session().sendoutAndReturn(sParams)
 	if err != nil {
-		return ""
+		return "", err
 	}
-
-	return sRes
+	if err = unmarshalReply(b, &sRes); err != nil {
+		return "", err
+	}
+	// The text may be changed by a user, keep it to restore after reconnecting.
+	o.session().record(o, sName+".text", protocol.Set{Name: sName, Prop: "text", Value: sRes})
+	return sRes, nil
 }
 
 // Method SetColor sets a text color tColor and background color bColor to a widget, pointed by o.
-func (o *Widget) SetColor(tColor int32, bColor int32) {
+func (o *Widget) SetColor(tColor int32, bColor int32) error {
 
 	var sName = widgFullName(o)
 
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"color\",[%d,%d]]", sName, tColor, bColor)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "color", Value: []int32{tColor, bColor}}
+	o.session().record(o, sName+".color", sParams)
+	return o.session().sendout(sParams)
+}
+
+// Method SetTooltip sets a tooltip sTooltip to a widget, pointed by o, an empty string removes it.
+func (o *Widget) SetTooltip(sTooltip string) error {
+
+	var sName = widgFullName(o)
+	o.Tooltip = sTooltip
+	sParams := protocol.Set{Name: sName, Prop: "tooltip", Value: sTooltip}
+	o.session().record(o, sName+".tooltip", sParams)
+	return o.session().sendout(sParams)
 }
 
 // Method SetFont sets a font pFont to a widget, pointed by o.
-func (o *Widget) SetFont(pFont *Font) {
+func (o *Widget) SetFont(pFont *Font) error {
 
 	var sName = widgFullName(o)
 	o.Font = pFont
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"font\",\"%s\"]", sName, pFont.Name)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "font", Value: pFont.Name}
+	o.session().record(o, sName+".font", sParams)
+	return o.session().sendout(sParams)
+}
+
+// SetCallBackProc sets a callback sbName ("onclick", "onsize", etc.) of a widget o.
+// fu - a function in the program, which is called with a widget name, values of code block
+// parameters (a position for "onposchanged", a column and a row for "onrclick" and "onenter",
+// see mBlockPars) and params; sCode - the identifier of this function, if it is empty, a unique one
+// is generated and the function is unregistered, when the widget is deleted or
+// other function is set for this callback. If fu is nil, sCode contains the Harbour's code.
+// See also OnClick and On.
+func (o *Widget) SetCallBackProc(sbName string, fu func([]string) string, sCode string, params ...string) error {
+	return o.setCallBackProc(sbName, mBlockPars[sbName], fu, sCode, params...)
 }
 
-func (o *Widget) SetCallBackProc(sbName string, fu func([]string) string, sCode string, params ...string) {
+// setCallBackProc is the same as SetCallBackProc, sPars are code block parameters.
+func (o *Widget) setCallBackProc(sbName string, sPars string, fu func([]string) string, sCode string, params ...string) error {
 
 	var sName = widgFullName(o)
-	var sc1, sc2 string
 
 	if fu != nil {
-		RegFunc(sCode, fu)
-		if sbName == "onposchanged" {
-			sc1 = "o,n"
-			sc2 = ",n"
-		} else if sbName == "onrclick" || sbName == "onenter" {
-			sc1 = "o,nc,nr"
-			sc2 = ",nc,nr"
-		} else {
-			sc1 = ""
-			sc2 = ""
-		}
-		sCode = "{|" + sc1 + "|pgo(\"" + sCode + "\",{\"" + sName + "\"" + sc2
-		for _, v := range params {
-			sCode += ",\"" + v + "\""
-		}
-		sCode += "})}"
+		sCode = o.session().callback(o, "cb."+sbName, false, fu, sCode)
+		sCode = protocol.CallProc(sPars, sCode, append([]string{sName}, params...)...)
 	}
-	b, _ := json.Marshal(sCode)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"cb.%s\",%s]", sName, sbName, string(b))
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "cb." + sbName, Value: sCode}
+	o.session().record(o, sName+".cb."+sbName, sParams)
+	return o.session().sendout(sParams)
 }
 
-func (o *Widget) SetCallBackFunc(sbName string, fu func([]string) string, sCode string, params ...string) {
+// SetCallBackFunc is the same as SetCallBackProc, but the fu result is returned to the GuiServer.
+// See also OnFunc.
+func (o *Widget) SetCallBackFunc(sbName string, fu func([]string) string, sCode string, params ...string) error {
 
 	var sName = widgFullName(o)
 
 	if fu != nil {
-		RegFunc(sCode, fu)
-		sCode = "fgo(\"" + sCode + "\",{\"" + sName + "\""
-		for _, v := range params {
-			sCode += ",\"" + v + "\""
-		}
-		sCode += "})"
+		sCode = o.session().callback(o, "cb."+sbName, false, fu, sCode)
+		sCode = protocol.CallFunc(sCode, append([]string{sName}, params...)...)
 	}
-	b, _ := json.Marshal(sCode)
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"cb.%s\",%s]", sName, sbName, string(b))
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "cb." + sbName, Value: sCode}
+	o.session().record(o, sName+".cb."+sbName, sParams)
+	return o.session().sendout(sParams)
 }
 
-func (o *Widget) Move(iLeft, iTop, iWidth, iHeight int32) {
+func (o *Widget) Move(iLeft, iTop, iWidth, iHeight int32) error {
 
 	var sName = widgFullName(o)
 
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"move\",[%d,%d,%d,%d]]", sName, iLeft, iTop, iWidth, iHeight)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "move", Value: []int32{iLeft, iTop, iWidth, iHeight}}
+	o.session().record(o, sName+".move", sParams)
+	return o.session().sendout(sParams)
 }
 
 // Method Enable enables or disables a widget, pointed by o.
-func (o *Widget) Enable(bEnable bool) {
+func (o *Widget) Enable(bEnable bool) error {
 
 	var sName = widgFullName(o)
 
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"enable\",%t]", sName, bEnable)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "enable", Value: bEnable}
+	o.session().record(o, sName+".enable", sParams)
+	return o.session().sendout(sParams)
 }
 
 // Method Hide hides or shows a widget, pointed by o.
-func (o *Widget) Hide(bHide bool) {
+func (o *Widget) Hide(bHide bool) error {
 
 	var sName = widgFullName(o)
 
-	sParams := fmt.Sprintf("[\"set\",\"%s\",\"hide\",%t]", sName, bHide)
-	sendout(sParams)
+	sParams := protocol.Set{Name: sName, Prop: "hide", Value: bHide}
+	o.session().record(o, sName+".hide", sParams)
+	return o.session().sendout(sParams)
 }
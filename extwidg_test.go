@@ -0,0 +1,193 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package external_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	egui "github.com/alkresin/external"
+	"github.com/alkresin/external/externaltest"
+)
+
+func TestDestroy(t *testing.T) {
+	for _, bReject := range []bool{false, true} {
+		srv := externaltest.NewServer()
+		if bReject {
+			srv.Unsupported = []string{"set.destroy"}
+		}
+		s := dial(t, srv, func(o *egui.Options) { o.Reconnect = true })
+		pWnd := mainWindow(t, s)
+		pPnl, _ := pWnd.Add(&egui.Widget{Type: "panel", Name: "pnl"})
+		pEdt, _ := pPnl.Add(&egui.Widget{Type: "edit", Name: "edt"})
+		pBtn, _ := pPnl.Add(&egui.Widget{Type: "button", Name: "btn"})
+		pWnd.Add(&egui.Widget{Type: "label", Name: "lbl"})
+		pEdt.SetText("text")
+		pBtn.OnClick(func(egui.ClickEvent) {})
+		o, _ := srv.Widget("main.pnl.btn")
+		m := reHandler.FindStringSubmatch(o.Callbacks["onclick"])
+		if m == nil {
+			t.Fatalf("onclick: %q", o.Callbacks["onclick"])
+		}
+		activate(t, srv, pWnd)
+
+		if err := pPnl.Destroy(); err != nil {
+			t.Fatalf("reject %v: %v", bReject, err)
+		}
+		o, bOk := srv.Widget("main.pnl")
+		if bReject && (!bOk || !o.Hidden) || !bReject && bOk {
+			t.Errorf("reject %v: the panel on the server %+v, %v", bReject, o, bOk)
+		}
+		if _, bOk = srv.Widget("main.pnl.edt"); bOk != bReject {
+			t.Errorf("reject %v: the edit on the server %v", bReject, bOk)
+		}
+		for _, sName := range []string{"main.pnl", "main.pnl.edt", "main.pnl.btn"} {
+			if s.Widg(sName) != nil {
+				t.Errorf("reject %v: %s remains in the program", bReject, sName)
+			}
+		}
+		if a := egui.FindAll(pWnd, egui.Select("")); len(a) != 1 || a[0].Name != "lbl" {
+			t.Errorf("reject %v: %d widgets in the window", bReject, len(a))
+		}
+		if _, err := srv.RunFunc(m[1]); err == nil {
+			t.Errorf("reject %v: the handler %s remains", bReject, m[1])
+		}
+
+		// The panel isn't restored after reconnecting, the label is.
+		aMsg := strings.Join(egui.Recorded(pWnd), "\n")
+		if strings.Contains(aMsg, `"main.pnl`) || !strings.Contains(aMsg, `"main.lbl"`) {
+			t.Errorf("reject %v: recorded\n%s", bReject, aMsg)
+		}
+	}
+}
+
+func TestActivateClose(t *testing.T) {
+	srv := externaltest.NewServer()
+	s := dial(t, srv)
+	pWnd := mainWindow(t, s)
+	pBtn, _ := pWnd.Add(&egui.Widget{Type: "button", Name: "btn"})
+	if pBtn.Activate() || pBtn.ActivateErr() == nil {
+		t.Error("a button is activated")
+	}
+	if pBtn.Close() || pBtn.CloseErr() == nil {
+		t.Error("a button is closed")
+	}
+
+	pDlg := &egui.Widget{Name: "dlg", Title: "Dialog", W: 200, H: 100}
+	s.InitDialog(pDlg)
+	if !pDlg.Activate() {
+		t.Error("the dialog isn't activated")
+	}
+	if o, _ := srv.Widget("dlg"); !o.Active {
+		t.Error("the dialog isn't active on the server")
+	}
+	if err := pDlg.CloseErr(); err != nil {
+		t.Fatal(err)
+	}
+	if _, bOk := srv.Widget("dlg"); bOk || s.Wnd("dlg") != nil {
+		t.Error("the dialog isn't closed")
+	}
+
+	srv.Unsupported = []string{"close"}
+	pDlg = &egui.Widget{Name: "dlg2", Title: "Dialog", W: 200, H: 100}
+	s.InitDialog(pDlg)
+	if pDlg.Close() {
+		t.Error("a rejected close is reported as successful")
+	}
+}
+
+// logBuffer keeps a log of a session, it may be read, while the session writes it.
+type logBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+func TestAddRejected(t *testing.T) {
+	srv := externaltest.NewServer()
+	srv.Unsupported = []string{"addwidg"}
+	pLog := &logBuffer{}
+	s := dial(t, srv, func(o *egui.Options) { o.Reconnect = true }, egui.WithLogger(slog.New(slog.NewTextHandler(pLog, nil))))
+	pWnd := mainWindow(t, s)
+
+	if o, err := pWnd.Add(&egui.Widget{Type: "edit", Name: "edt"}); o != nil || err == nil {
+		t.Errorf("Add: %v, %v", o, err)
+	}
+	if o := pWnd.AddWidget(&egui.Widget{Type: "label", Name: "lbl"}); o == nil {
+		t.Error("AddWidget returns nil for a rejected widget")
+	}
+	if o := pWnd.AddWidget(&egui.Widget{Type: "nosuchtype", Name: "w1"}); o != nil {
+		t.Error("AddWidget returns a widget of an unknown type")
+	}
+	for _, sName := range []string{"main.edt", "main.lbl", "main.w1"} {
+		if s.Widg(sName) != nil {
+			t.Errorf("%s is registered", sName)
+		}
+	}
+	if a := egui.FindAll(pWnd, egui.Select("")); len(a) != 0 {
+		t.Errorf("%d widgets in the window", len(a))
+	}
+	if aMsg := strings.Join(egui.Recorded(pWnd), "\n"); strings.Contains(aMsg, "addwidg") {
+		t.Errorf("recorded\n%s", aMsg)
+	}
+	sLog := pLog.String()
+	for _, sName := range []string{"widget=lbl", "widget=w1"} {
+		if !strings.Contains(sLog, sName) {
+			t.Errorf("%s isn't logged:\n%s", sName, sLog)
+		}
+	}
+}
+
+func TestLastGlobals(t *testing.T) {
+	srvDef := externaltest.NewServer()
+	optsDef := srvDef.Pipe()
+	if iRes := egui.Init("", func(o *egui.Options) {
+		*o = egui.Options{Transport: optsDef.Transport}
+		o.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}); iRes != 0 {
+		t.Fatalf("Init: %d", iRes)
+	}
+	t.Cleanup(func() {
+		egui.Exit()
+		srvDef.Close()
+	})
+	pWndDef := &egui.Widget{Title: "Main", W: 400, H: 300}
+	egui.InitMainWindow(pWndDef)
+	pLblDef := pWndDef.AddWidget(&egui.Widget{Type: "label", Name: "lbl"})
+
+	// Other sessions don't change the globals.
+	s := dial(t, externaltest.NewServer())
+	pWnd := mainWindow(t, s)
+	pEdt, _ := pWnd.Add(&egui.Widget{Type: "edit", Name: "edt"})
+	if egui.PLastWindow != pWndDef || egui.PLastWidget != pLblDef {
+		t.Errorf("globals are changed by other session: %v, %v", egui.PLastWindow, egui.PLastWidget)
+	}
+	if s.LastWindow() != pWnd || s.LastWidget() != pEdt {
+		t.Errorf("last of the session: %v, %v", s.LastWindow(), s.LastWidget())
+	}
+	if d := egui.DefaultSession(); d.LastWindow() != pWndDef || d.LastWidget() != pLblDef {
+		t.Errorf("last of the default session: %v, %v", d.LastWindow(), d.LastWidget())
+	}
+
+	pEdt.Destroy()
+	if s.LastWidget() != nil || egui.PLastWidget != pLblDef {
+		t.Errorf("after Destroy: %v, %v", s.LastWidget(), egui.PLastWidget)
+	}
+}
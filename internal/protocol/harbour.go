@@ -0,0 +1,78 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"strings"
+)
+
+// HbString returns s as a Harbour string literal. Harbour has no escape sequences,
+// so a delimiter, which isn't found in s, is chosen: "...", '...' or [...];
+// if s contains all of them, it is split to parts, joined with '+'.
+func HbString(s string) string {
+	if !strings.Contains(s, "\"") {
+		return "\"" + s + "\""
+	}
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	if !strings.Contains(s, "]") {
+		return "[" + s + "]"
+	}
+	aParts := strings.Split(s, "\"")
+	for i, v := range aParts {
+		aParts[i] = HbString(v)
+	}
+	return "(" + strings.Join(aParts, "+'\"'+") + ")"
+}
+
+// HbArray returns a Harbour array literal of strings: {"a","b"}.
+func HbArray(aItems ...string) string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, v := range aItems {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(HbString(v))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// CallProc returns a Harbour code, which calls a procedure sName of a program
+// with parameters: the code block parameters sBlockPars, if any, are added after aItems[0]:
+//
+//	{|o,n|pgo("name",{"main.w1",n,"p1"})}
+func CallProc(sBlockPars string, sName string, aItems ...string) string {
+	return "{|" + sBlockPars + "|pgo(" + HbString(sName) + "," + hbArrayWith(sBlockPars, aItems) + ")}"
+}
+
+// CallFunc returns a Harbour code, which calls a function sName of a program: fgo("name",{...})
+func CallFunc(sName string, aItems ...string) string {
+	return "fgo(" + HbString(sName) + "," + HbArray(aItems...) + ")"
+}
+
+// Pgo returns a Harbour expression, which calls a procedure sName of a program: pgo("name",{...})
+func Pgo(sName string, aItems ...string) string {
+	return "pgo(" + HbString(sName) + "," + HbArray(aItems...) + ")"
+}
+
+// hbArrayWith is HbArray, but code block parameters sBlockPars, except the first one,
+// are inserted after a first item.
+func hbArrayWith(sBlockPars string, aItems []string) string {
+	aPars := strings.Split(sBlockPars, ",")
+	if sBlockPars == "" || len(aPars) < 2 || len(aItems) == 0 {
+		return HbArray(aItems...)
+	}
+	s := HbArray(aItems[0])
+	s = s[:len(s)-1] + "," + strings.Join(aPars[1:], ",")
+	if len(aItems) > 1 {
+		s += "," + HbArray(aItems[1:]...)[1:]
+	} else {
+		s += "}"
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+// hbEval evaluates a Harbour expression of string literals, joined by '+',
+// as HbString makes it; ok is false, if the expression is wrong.
+func hbEval(s string) (sRes string, bOk bool) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+	for s != "" {
+		var cEnd byte
+		switch s[0] {
+		case '"', '\'':
+			cEnd = s[0]
+		case '[':
+			cEnd = ']'
+		default:
+			return "", false
+		}
+		npos := strings.IndexByte(s[1:], cEnd)
+		if npos < 0 {
+			return "", false
+		}
+		sRes += s[1 : npos+1]
+		s = s[npos+2:]
+		if s != "" {
+			if s[0] != '+' {
+				return "", false
+			}
+			s = s[1:]
+		}
+	}
+	return sRes, true
+}
+
+func TestHbString(t *testing.T) {
+	for _, tc := range []struct {
+		s, sWant string
+	}{
+		{``, `""`},
+		{`abc`, `"abc"`},
+		{`a"b`, `'a"b'`},
+		{`a"b'c`, `[a"b'c]`},
+		{`a"b'c]`, `("a"+'"'+"b'c]")`},
+		{`"'[]"`, `(""+'"'+"'[]"+'"'+"")`},
+	} {
+		sRes := HbString(tc.s)
+		if sRes != tc.sWant {
+			t.Errorf("HbString(%q) = %s, want %s", tc.s, sRes, tc.sWant)
+		}
+		if sBack, bOk := hbEval(sRes); !bOk || sBack != tc.s {
+			t.Errorf("HbString(%q) = %s is evaluated to %q, %v", tc.s, sRes, sBack, bOk)
+		}
+	}
+}
+
+func TestHbArray(t *testing.T) {
+	if s := HbArray(); s != "{}" {
+		t.Errorf("HbArray() = %s", s)
+	}
+	if s := HbArray("a", `b"`); s != `{"a",'b"'}` {
+		t.Errorf("HbArray(a, b\") = %s", s)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package protocol describes messages, which are sent to a GuiServer, and their replies.
+// A message is a JSON array, its first item is a command name; all messages are
+// marshalled by encoding/json, so strings are always escaped properly.
+package protocol
+
+import (
+	"encoding/json"
+)
+
+// Msg is a message to a GuiServer.
+type Msg interface {
+	// Array returns items of a JSON array, which represents the message.
+	Array() []interface{}
+}
+
+// Marshal returns the JSON encoding of a message m.
+func Marshal(m Msg) ([]byte, error) {
+	return json.Marshal(m.Array())
+}
+
+// Cmd is a message, which consists of a command name and its arguments,
+// it is used for commands without a dedicated type.
+type Cmd struct {
+	Name string
+	Args []interface{}
+}
+
+// NewCmd returns a Cmd with a name sName and arguments args.
+func NewCmd(sName string, args ...interface{}) Cmd {
+	return Cmd{Name: sName, Args: args}
+}
+
+func (m Cmd) Array() []interface{} {
+	return append([]interface{}{m.Name}, m.Args...)
+}
+
+// Rect is a position and a size of a window or a widget together with its title,
+// as they are passed to a GuiServer.
+type Rect struct {
+	X, Y, W, H int
+	Title      string
+}
+
+func (r Rect) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{r.X, r.Y, r.W, r.H, r.Title})
+}
+
+// Props are optional properties of a window or a widget: Winstyle, TColor, Font, etc.
+// Raw values (numbers and arrays from Widget.AProps) are passed as json.RawMessage.
+type Props map[string]interface{}
+
+// CrMainWnd creates a main window.
+type CrMainWnd struct {
+	Rect  Rect
+	Props Props
+}
+
+func (m CrMainWnd) Array() []interface{} {
+	return withProps([]interface{}{"crmainwnd", m.Rect}, m.Props)
+}
+
+// CrDialog creates a dialog window.
+type CrDialog struct {
+	Name  string
+	Rect  Rect
+	Props Props
+}
+
+func (m CrDialog) Array() []interface{} {
+	return withProps([]interface{}{"crdialog", m.Name, m.Rect}, m.Props)
+}
+
+// AddWidg adds a widget of a Type with a full Name (window.parent.widget) to a window.
+type AddWidg struct {
+	Type  string
+	Name  string
+	Rect  Rect
+	Props Props
+}
+
+func (m AddWidg) Array() []interface{} {
+	return withProps([]interface{}{"addwidg", m.Type, m.Name, m.Rect}, m.Props)
+}
+
+func withProps(args []interface{}, props Props) []interface{} {
+	if len(props) > 0 {
+		args = append(args, props)
+	}
+	return args
+}
+
+// Set sets a property Prop of a widget with a full Name to Value.
+type Set struct {
+	Name  string
+	Prop  string
+	Value interface{}
+}
+
+func (m Set) Array() []interface{} {
+	return []interface{}{"set", m.Name, m.Prop, m.Value}
+}
+
+// Get requests a property Prop of a widget with a full Name.
+type Get struct {
+	Name string
+	Prop string
+}
+
+func (m Get) Array() []interface{} {
+	return []interface{}{"get", m.Name, m.Prop}
+}
+
+// Common calls a standard dialog (a messagebox, a file selection, etc.) of a Kind;
+// Func and Name define a callback procedure and its parameter.
+type Common struct {
+	Kind string
+	Func string
+	Name string
+	Args []interface{}
+}
+
+func (m Common) Array() []interface{} {
+	return append([]interface{}{"common", m.Kind, m.Func, m.Name}, m.Args...)
+}
+
+// Print performs a printing operation of a Kind with a printer.
+type Print struct {
+	Kind    string
+	Printer string
+	Args    []interface{}
+}
+
+func (m Print) Array() []interface{} {
+	args := m.Args
+	if args == nil {
+		args = []interface{}{}
+	}
+	return []interface{}{"print", m.Kind, m.Printer, args}
+}
+
+// CrFont creates a font.
+type CrFont struct {
+	Name      string
+	Family    string
+	Height    int
+	Bold      bool
+	Italic    bool
+	Underline bool
+	Strikeout bool
+	Charset   int16
+}
+
+func (m CrFont) Array() []interface{} {
+	return []interface{}{"crfont", m.Name, m.Family, m.Height, m.Bold, m.Italic, m.Underline, m.Strikeout, m.Charset}
+}
+
+// CrStyle creates a style.
+type CrStyle struct {
+	Name      string
+	Colors    []int32
+	Orient    int16
+	Corners   []int32
+	BorderW   int8
+	BorderClr int32
+	Bitmap    string
+}
+
+func (m CrStyle) Array() []interface{} {
+	return []interface{}{"crstyle", m.Name, m.Colors, m.Orient, m.Corners, m.BorderW, m.BorderClr, m.Bitmap}
+}
+
+// Packet joins several messages to one.
+type Packet []json.RawMessage
+
+func (m Packet) Array() []interface{} {
+	args := make([]interface{}, 0, len(m)+1)
+	args = append(args, "packet")
+	for _, v := range m {
+		args = append(args, v)
+	}
+	return args
+}
+
+// MenuItem is an item of a menu; Code is a Harbour code, which is executed,
+// when the item is selected.
+type MenuItem struct {
+	Title string
+	Code  string
+	Id    int
+	Check bool // The item may be checked
+}
+
+func (m MenuItem) MarshalJSON() ([]byte, error) {
+	if m.Check {
+		return json.Marshal([]interface{}{m.Title, m.Code, m.Id, true})
+	}
+	return json.Marshal([]interface{}{m.Title, m.Code, m.Id})
+}
+
+// MenuSeparator is a separator between menu items.
+type MenuSeparator struct{}
+
+func (m MenuSeparator) MarshalJSON() ([]byte, error) {
+	return []byte(`["-"]`), nil
+}
+
+// SubMenu is a submenu with a Title and Items: MenuItem, MenuSeparator or SubMenu.
+type SubMenu struct {
+	Title string
+	Items []interface{}
+}
+
+func (m SubMenu) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{m.Title, items(m.Items)})
+}
+
+// Menu creates a menu of a last created window.
+type Menu struct {
+	Items []interface{}
+}
+
+func (m Menu) Array() []interface{} {
+	return []interface{}{"menu", items(m.Items)}
+}
+
+// MenuContext creates a context menu with a Name.
+type MenuContext struct {
+	Name  string
+	Items []interface{}
+}
+
+func (m MenuContext) Array() []interface{} {
+	return []interface{}{"menucontext", "create", m.Name, items(m.Items)}
+}
+
+func items(a []interface{}) []interface{} {
+	if a == nil {
+		return []interface{}{}
+	}
+	return a
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Alexander S.Kresin <alex@kresin.ru>, http://www.kresin.ru
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Replies, which are sent to a GuiServer in answer to its messages.
+var (
+	ReplyOk      = []byte(`["Ok"]`)
+	ReplyErr     = []byte(`["Err"]`)
+	ReplyError   = []byte(`["Error"]`)
+	ReplyGoodbye = []byte(`["Goodbye"]`)
+)
+
+// ErrRejected is returned by Decode, when a GuiServer reports an error instead of a result.
+var ErrRejected = errors.New("protocol: message is rejected")
+
+// trim removes the framing, if any, from a message b.
+func trim(b []byte) []byte {
+	return bytes.TrimPrefix(bytes.TrimRight(b, "\r\n"), []byte("+"))
+}
+
+// IsRejected reports, whether a reply b is an error report.
+func IsRejected(b []byte) bool {
+	b = trim(b)
+	return bytes.HasPrefix(b, []byte("Err")) || bytes.HasPrefix(b, []byte(`["Err`))
+}
+
+// Decode decodes a reply b to v. If b isn't a valid JSON and it is an error report,
+// ErrRejected is returned.
+func Decode(b []byte, v interface{}) error {
+	b = trim(b)
+	if err := json.Unmarshal(b, v); err != nil {
+		if IsRejected(b) {
+			return ErrRejected
+		}
+		return err
+	}
+	return nil
+}
+
+// DecodeEvent decodes a message of a GuiServer: an event name and its arguments,
+// for example, ["runproc","name","[\"param\"]"].
+func DecodeEvent(b []byte) ([]string, error) {
+	var arr []string
+	if err := json.Unmarshal(trim(b), &arr); err != nil {
+		return nil, err
+	}
+	return arr, nil
+}